@@ -0,0 +1,202 @@
+package httpmitm
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// MockInfo describes a registered mock with its invocations
+type MockInfo struct {
+	Method    string `json:"method"`
+	URL       string `json:"url"`
+	Expected  int    `json:"expected"` // -1 for unlimited times
+	Invoked   int    `json:"invoked"`
+	Scenario  string `json:"scenario,omitempty"`
+	WhenState string `json:"whenState,omitempty"`
+	ThenState string `json:"thenState,omitempty"`
+}
+
+// Stubs returns all registered mocks sorted by url and method
+func (mitm *MitmTransport) Stubs() []*MockInfo {
+	var mocks []*MockInfo
+	for _, stub := range mitm.Snapshot().Stubs {
+		mocks = append(mocks, &MockInfo{
+			Method:    stub.Method,
+			URL:       stub.URL,
+			Expected:  stub.Expected,
+			Invoked:   stub.Invoked,
+			Scenario:  stub.Scenario,
+			WhenState: stub.WhenState,
+			ThenState: stub.ThenState,
+		})
+	}
+
+	return mocks
+}
+
+// AdminHandler serves JSON API for managing mocks at runtime, it should be served on a separate listener of mocks.
+//
+//	GET    /mocks                  lists registered mocks with expected and invoked times
+//	POST   /mocks                  creates mocks of definitions in JSON or YAML, see Definitions
+//	DELETE /mocks?method=&url=     deletes mock of method and url
+//	GET    /history                lists requests issued with mitm scheme
+//	DELETE /history                clears request history
+//	POST   /reset                  removes all mocks and history, and resets scenarios
+//	POST   /pause                  pauses all mocks
+//	POST   /resume                 resumes all mocks
+//	GET    /status                 returns paused state with numbers of mocks and requests
+type AdminHandler struct {
+	mux sync.Mutex
+
+	mitm   *MitmTransport
+	routes *http.ServeMux
+}
+
+// AdminHandler returns *AdminHandler of stubs
+func (mitm *MitmTransport) AdminHandler() *AdminHandler {
+	admin := &AdminHandler{
+		mitm:   mitm,
+		routes: http.NewServeMux(),
+	}
+
+	admin.routes.HandleFunc("GET /mocks", admin.listMocks)
+	admin.routes.HandleFunc("POST /mocks", admin.createMocks)
+	admin.routes.HandleFunc("DELETE /mocks", admin.deleteMock)
+	admin.routes.HandleFunc("GET /history", admin.listHistory)
+	admin.routes.HandleFunc("DELETE /history", admin.resetHistory)
+	admin.routes.HandleFunc("POST /reset", admin.reset)
+	admin.routes.HandleFunc("POST /pause", admin.pause)
+	admin.routes.HandleFunc("POST /resume", admin.resume)
+	admin.routes.HandleFunc("GET /status", admin.status)
+
+	return admin
+}
+
+// ServeHTTP implements http.Handler
+func (admin *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// NOTE: mocking is a chained invocation, which should be serialized
+	admin.mux.Lock()
+	defer admin.mux.Unlock()
+
+	admin.routes.ServeHTTP(w, r)
+}
+
+func (admin *AdminHandler) listMocks(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+		"mocks": nonNilMocks(admin.mitm.Stubs()),
+	})
+}
+
+func (admin *AdminHandler) createMocks(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	defs, err := ParseDefinitions("request", data)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := admin.mitm.MockDefinitions(defs); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	created := map[string]bool{}
+	for _, def := range defs.Mocks {
+		created[strings.ToUpper(def.Method)+" "+def.URL] = true
+	}
+
+	var mocks []*MockInfo
+	for _, info := range admin.mitm.Stubs() {
+		if created[info.Method+" "+info.URL] {
+			mocks = append(mocks, info)
+		}
+	}
+
+	writeAdminJSON(w, http.StatusCreated, map[string]interface{}{
+		"mocks": nonNilMocks(mocks),
+	})
+}
+
+func (admin *AdminHandler) deleteMock(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	method, rawurl := query.Get("method"), query.Get("url")
+	if method == "" || rawurl == "" {
+		writeAdminError(w, http.StatusBadRequest, ErrInvocation)
+		return
+	}
+
+	if !admin.mitm.Unmock(method, rawurl) {
+		writeAdminError(w, http.StatusNotFound, ErrNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (admin *AdminHandler) listHistory(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+		"requests": admin.mitm.History(),
+	})
+}
+
+func (admin *AdminHandler) resetHistory(w http.ResponseWriter, r *http.Request) {
+	admin.mitm.ResetHistory()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (admin *AdminHandler) reset(w http.ResponseWriter, r *http.Request) {
+	admin.mitm.Reset()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (admin *AdminHandler) pause(w http.ResponseWriter, r *http.Request) {
+	admin.mitm.SetPaused(true)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (admin *AdminHandler) resume(w http.ResponseWriter, r *http.Request) {
+	admin.mitm.SetPaused(false)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (admin *AdminHandler) status(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+		"paused":   admin.mitm.IsPaused(),
+		"mocks":    len(admin.mitm.Stubs()),
+		"requests": len(admin.mitm.History()),
+	})
+}
+
+func nonNilMocks(mocks []*MockInfo) []*MockInfo {
+	if mocks == nil {
+		return []*MockInfo{}
+	}
+
+	return mocks
+}
+
+func writeAdminJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAdminError(w http.ResponseWriter, code int, err error) {
+	writeAdminJSON(w, code, map[string]string{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,138 @@
+package httpmitm
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_MitmTransportStubs(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, nil, "").AnyTimes()
+	mt.MockRequest("POST", "https://api.example.com/users").WithResponse(201, nil, "").Times(2)
+	mt.MockRequest("GET", "https://api.example.com/state").InScenario("login").WhenState(ScenarioStarted).ThenState("logged").WithResponse(200, nil, "")
+
+	response, err := http.Post("mitm://api.example.com/users", "", nil)
+	it.Nil(err)
+	response.Body.Close()
+
+	response, err = http.Post("mitm://api.example.com/users", "", nil)
+	it.Nil(err)
+	response.Body.Close()
+
+	stubs := mt.Stubs()
+	if it.Equal(3, len(stubs)) {
+		it.Equal(&MockInfo{Method: "GET", URL: "https://api.example.com/state", Expected: 1, Scenario: "login", WhenState: ScenarioStarted, ThenState: "logged"}, stubs[0])
+		it.Equal(&MockInfo{Method: "GET", URL: "https://api.example.com/users", Expected: -1}, stubs[1])
+		it.Equal(&MockInfo{Method: "POST", URL: "https://api.example.com/users", Expected: 2, Invoked: 2}, stubs[2])
+	}
+
+	it.True(mt.Unmock("GET", "https://api.example.com/users"))
+	it.False(mt.Unmock("GET", "https://api.example.com/users"))
+	it.Equal(2, len(mt.Stubs()))
+}
+
+func Test_MitmTransportAdminHandler(t *testing.T) {
+	mt := NewMitmTransport()
+
+	it := assert.New(t)
+
+	admin := httptest.NewServer(mt.AdminHandler())
+	defer admin.Close()
+
+	srv := mt.Server()
+	defer srv.Close()
+
+	client := &http.Client{
+		Transport: &http.Transport{},
+	}
+
+	do := func(method, path, body string) (int, map[string]interface{}) {
+		request, _ := http.NewRequest(method, admin.URL+path, strings.NewReader(body))
+
+		response, err := client.Do(request)
+		if err != nil {
+			return 0, nil
+		}
+		defer response.Body.Close()
+
+		var data map[string]interface{}
+		json.NewDecoder(response.Body).Decode(&data)
+
+		return response.StatusCode, data
+	}
+
+	// create mocks
+	code, data := do("POST", "/mocks", `{"mocks": [{"method": "GET", "url": "http://api.example.com/users", "times": "any", "response": {"status": 200, "body": "users"}}]}`)
+	it.Equal(http.StatusCreated, code)
+	it.Equal(1, len(data["mocks"].([]interface{})))
+
+	code, data = do("POST", "/mocks", `[{"method": "GET", "url": "/relative", "response": {"status": 200}}]`)
+	it.Equal(http.StatusBadRequest, code)
+	it.Contains(data["error"], "absolute url is required")
+
+	// serve mocks
+	for i := 0; i < 2; i++ {
+		response, err := client.Get(srv.URL + "/users")
+		if it.Nil(err) {
+			b, _ := io.ReadAll(response.Body)
+			response.Body.Close()
+			it.Equal("users", string(b))
+		}
+	}
+
+	code, data = do("GET", "/mocks", "")
+	it.Equal(http.StatusOK, code)
+	it.Equal([]interface{}{
+		map[string]interface{}{"method": "GET", "url": "http://api.example.com/users", "expected": float64(-1), "invoked": float64(2)},
+	}, data["mocks"])
+
+	code, data = do("GET", "/history", "")
+	it.Equal(http.StatusOK, code)
+	if requests, ok := data["requests"].([]interface{}); it.True(ok) && it.Equal(2, len(requests)) {
+		request := requests[0].(map[string]interface{})
+		it.Equal("GET", request["method"])
+		it.Equal("http://api.example.com/users", request["url"])
+		it.Equal(float64(200), request["status"])
+	}
+
+	// pause and resume
+	code, _ = do("POST", "/pause", "")
+	it.Equal(http.StatusNoContent, code)
+
+	_, data = do("GET", "/status", "")
+	it.Equal(map[string]interface{}{"paused": true, "mocks": float64(1), "requests": float64(2)}, data)
+
+	do("POST", "/resume", "")
+	it.False(mt.IsPaused())
+
+	// delete mocks
+	code, _ = do("DELETE", "/mocks?method=GET&url=http://api.example.com/unknown", "")
+	it.Equal(http.StatusNotFound, code)
+
+	code, _ = do("DELETE", "/mocks?method=GET&url=http://api.example.com/users", "")
+	it.Equal(http.StatusNoContent, code)
+
+	_, data = do("GET", "/mocks", "")
+	it.Equal([]interface{}{}, data["mocks"])
+
+	// reset
+	do("POST", "/mocks", `[{"method": "GET", "url": "http://api.example.com/users", "response": {"status": 200}}]`)
+
+	code, _ = do("POST", "/reset", "")
+	it.Equal(http.StatusNoContent, code)
+	it.Empty(mt.Stubs())
+	it.Empty(mt.History())
+
+	code, _ = do("PUT", "/mocks", "")
+	it.Equal(http.StatusMethodNotAllowed, code)
+}
@@ -0,0 +1,241 @@
+package httpmitm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// ResponseLeak describes response body of mocks which is never closed or drained
+type ResponseLeak struct {
+	Method  string
+	URL     string // origin url of the request
+	Closed  bool
+	Drained bool
+	Stack   string // stack where the request was issued
+}
+
+func (leak *ResponseLeak) String() string {
+	var problems []string
+	if !leak.Closed {
+		problems = append(problems, "never closed")
+	}
+	if !leak.Drained {
+		problems = append(problems, "never drained")
+	}
+
+	return "response body of " + leak.Method + " " + leak.URL + " " + strings.Join(problems, " and ") + ", requested at\n" + leak.Stack
+}
+
+// WithResponseCloseCheck fails the test in UnstubDefaultTransport if any response body of mocks is never closed,
+// e.g. for detecting leaks of resp.Body.
+func (mitm *MitmTransport) WithResponseCloseCheck() *MitmTransport {
+	mitm.closeCheck.Store(true)
+
+	return mitm
+}
+
+// WithResponseLeakCheck fails t if any response body of mocks is never closed or never drained,
+// with the stack where the request was issued. It's reported by UnstubDefaultTransport or t.Cleanup, whichever comes first.
+func (mitm *MitmTransport) WithResponseLeakCheck(t testing.TB) *MitmTransport {
+	mitm.closeCheck.Store(true)
+	mitm.drainCheck.Store(true)
+
+	mitm.mux.Lock()
+	mitm.leakTesting = t
+	mitm.mux.Unlock()
+
+	t.Cleanup(func() {
+		t.Helper()
+
+		for _, leak := range mitm.ResponseLeaks() {
+			t.Errorf("%s", leak)
+		}
+
+		mitm.resetResponses()
+
+		mitm.mux.Lock()
+		mitm.leakTesting = nil
+		mitm.mux.Unlock()
+	})
+
+	return mitm
+}
+
+// UnclosedResponses returns requests whose response bodies of mocks are never closed, it's always empty
+// if WithResponseCloseCheck is not applied.
+func (mitm *MitmTransport) UnclosedResponses() []*RequestRecord {
+	mitm.bodiesMux.Lock()
+	defer mitm.bodiesMux.Unlock()
+
+	var records []*RequestRecord
+	for _, body := range mitm.bodies {
+		if !body.closed.Load() {
+			records = append(records, body.record)
+		}
+	}
+
+	return records
+}
+
+// ResponseLeaks returns response bodies of mocks which are never closed, or never drained if WithResponseLeakCheck applied.
+func (mitm *MitmTransport) ResponseLeaks() []*ResponseLeak {
+	drainCheck := mitm.drainCheck.Load()
+
+	mitm.bodiesMux.Lock()
+	defer mitm.bodiesMux.Unlock()
+
+	var leaks []*ResponseLeak
+	for _, body := range mitm.bodies {
+		closed, drained := body.closed.Load(), body.drained.Load()
+		if closed && (drained || !drainCheck) {
+			continue
+		}
+
+		leaks = append(leaks, &ResponseLeak{
+			Method:  body.record.Method,
+			URL:     body.record.URL,
+			Closed:  closed,
+			Drained: drained || !drainCheck,
+			Stack:   body.stack,
+		})
+	}
+
+	return leaks
+}
+
+// trackResponse replaces body of resp with one tracking close and drain if WithResponseCloseCheck applied
+func (mitm *MitmTransport) trackResponse(record *RequestRecord, resp *http.Response) {
+	if !mitm.closeCheck.Load() || resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+		return
+	}
+
+	// NOTE: body of upgraded response is a connection which is closed by server
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		return
+	}
+
+	body := &trackedBody{
+		ReadCloser: resp.Body,
+		record:     record,
+		length:     resp.ContentLength,
+		stack:      callerStack(),
+	}
+	resp.Body = body
+
+	mitm.bodiesMux.Lock()
+	mitm.bodies = append(mitm.bodies, body)
+	mitm.bodiesMux.Unlock()
+}
+
+// resetResponses removes all tracked bodies
+func (mitm *MitmTransport) resetResponses() {
+	mitm.bodiesMux.Lock()
+	defer mitm.bodiesMux.Unlock()
+
+	mitm.bodies = nil
+}
+
+// trackedBody marks itself drained after read to EOF and closed after closed
+type trackedBody struct {
+	io.ReadCloser
+
+	record  *RequestRecord
+	stack   string
+	length  int64 // -1 for unknown
+	read    atomic.Int64
+	once    sync.Once
+	closed  atomic.Bool
+	drained atomic.Bool
+}
+
+func (b *trackedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	read := b.read.Add(int64(n))
+	if err == io.EOF || (b.length >= 0 && read >= b.length) {
+		b.drained.Store(true)
+	}
+
+	return n, err
+}
+
+func (b *trackedBody) Close() error {
+	var err error
+
+	b.once.Do(func() {
+		b.closed.Store(true)
+
+		err = b.ReadCloser.Close()
+	})
+
+	return err
+}
+
+// callerStack returns stack of the caller issuing request, frames of httpmitm and net/http are omitted.
+func callerStack() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+
+	var buf strings.Builder
+	for {
+		frame, more := frames.Next()
+
+		if strings.HasPrefix(frame.Function, "testing.") || strings.HasPrefix(frame.Function, "runtime.") {
+			break
+		}
+
+		internal := filepath.Dir(frame.File) == packageDir && !strings.HasSuffix(frame.File, "_test.go")
+		if !internal && !strings.HasPrefix(frame.Function, "net/http.") {
+			fmt.Fprintf(&buf, "%s%s\n%s%s%s:%d\n", DefaultLeaddingSpace, frame.Function, DefaultLeaddingSpace, DefaultLeaddingSpace, frame.File, frame.Line)
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	return buf.String()
+}
+
+var packageDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+
+	return filepath.Dir(file)
+}()
+
+// bufferRequest reads and closes body of r as real transports do, and returns a shallow copy of r with buffered body,
+// which can be read by matchers and responders for many times.
+// NOTE: The caller's r.Body is consumed, so reusing r without GetBody is detected as mismatch of ContentLength.
+func bufferRequest(r *http.Request) (*http.Request, []byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return r, nil, nil
+	}
+
+	data, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrRequestBody, err)
+	}
+
+	if r.ContentLength > 0 && int64(len(data)) != r.ContentLength {
+		return nil, nil, fmt.Errorf("%w: ContentLength=%d with Body length %d", ErrRequestBody, r.ContentLength, len(data))
+	}
+
+	req := new(http.Request)
+	*req = *r
+
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	return req, data, nil
+}
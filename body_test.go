@@ -0,0 +1,256 @@
+package httpmitm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+type closeRecorder struct {
+	io.Reader
+
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+
+	return nil
+}
+
+func Test_MitmTransportWithRequestBody(t *testing.T) {
+	mt := NewMitmTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("POST", "https://api.example.com/users").ByMatcher(func(r *http.Request, urlobj *url.URL) bool {
+		data, _ := io.ReadAll(r.Body)
+
+		return string(data) == `{"name":"httpmitm"}`
+	}).WithCalleeResponse(func(r *http.Request) (int, http.Header, io.Reader, error) {
+		data, err := io.ReadAll(r.Body)
+
+		return 201, nil, strings.NewReader(string(data)), err
+	})
+
+	body := &closeRecorder{Reader: strings.NewReader(`{"name":"httpmitm"}`)}
+
+	request, _ := http.NewRequest("POST", "mitm://api.example.com/users", body)
+
+	response, err := mt.RoundTrip(request)
+	if it.Nil(err) {
+		data, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+
+		it.Equal(201, response.StatusCode)
+		it.Equal(`{"name":"httpmitm"}`, string(data))
+	}
+	it.True(body.closed)
+
+	history := mt.History()
+	if it.Equal(1, len(history)) {
+		it.Equal(`{"name":"httpmitm"}`, history[0].Body)
+	}
+}
+
+func Test_MitmTransportWithReusedRequestBody(t *testing.T) {
+	mt := NewMitmTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("POST", "https://api.example.com/users").WithResponse(201, nil, "").AnyTimes()
+
+	request, _ := http.NewRequest("POST", "mitm://api.example.com/users", strings.NewReader("data"))
+
+	response, err := mt.RoundTrip(request)
+	if it.Nil(err) {
+		response.Body.Close()
+	}
+
+	// body consumed by the first round trip
+	_, err = mt.RoundTrip(request)
+	it.True(errors.Is(err, ErrRequestBody))
+	it.Contains(err.Error(), "ContentLength=4 with Body length 0")
+
+	// rewind with GetBody
+	request.Body, _ = request.GetBody()
+
+	response, err = mt.RoundTrip(request)
+	if it.Nil(err) {
+		response.Body.Close()
+	}
+}
+
+func Test_MitmTransportWithRedirectBody(t *testing.T) {
+	mt := NewMitmTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("POST", "https://api.example.com/old").WithRedirectResponse(http.StatusTemporaryRedirect, "https://api.example.com/new")
+	mt.MockRequest("POST", "https://api.example.com/new").WithCalleeResponse(func(r *http.Request) (int, http.Header, io.Reader, error) {
+		data, err := io.ReadAll(r.Body)
+
+		return 201, nil, strings.NewReader(string(data)), err
+	})
+
+	client := &http.Client{Transport: mt}
+
+	response, err := client.Post("mitm://api.example.com/old", "text/plain", strings.NewReader("data"))
+	if it.Nil(err) {
+		data, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+
+		it.Equal(201, response.StatusCode)
+		it.Equal("data", string(data))
+	}
+
+	history := mt.History()
+	if it.Equal(2, len(history)) {
+		it.Equal("data", history[0].Body)
+		it.Equal("data", history[1].Body)
+	}
+}
+
+func Test_MitmTransportWithResponseCloseCheck(t *testing.T) {
+	mt := NewMitmTransport().WithResponseCloseCheck()
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, nil, "[]").AnyTimes()
+	mt.MockRequest("HEAD", "https://api.example.com/users").WithResponse(200, nil, "[]")
+
+	client := &http.Client{Transport: mt}
+
+	response, err := client.Get("mitm://api.example.com/users")
+	if !it.Nil(err) {
+		return
+	}
+
+	unclosed := mt.UnclosedResponses()
+	if it.Equal(1, len(unclosed)) {
+		it.Equal("GET", unclosed[0].Method)
+		it.Equal("https://api.example.com/users", unclosed[0].URL)
+	}
+
+	it.Nil(response.Body.Close())
+	it.Nil(response.Body.Close())
+	it.Empty(mt.UnclosedResponses())
+
+	// no body of HEAD
+	_, err = client.Head("mitm://api.example.com/users")
+	it.Nil(err)
+	it.Empty(mt.UnclosedResponses())
+
+	_, err = client.Get("mitm://api.example.com/users")
+	it.Nil(err)
+	it.Equal(1, len(mt.UnclosedResponses()))
+
+	mt.Reset()
+	it.Empty(mt.UnclosedResponses())
+}
+
+type cleanupRecorder struct {
+	testing.TB
+
+	cleanups []func()
+	errors   []string
+	failed   bool
+}
+
+func (c *cleanupRecorder) Helper() {}
+
+func (c *cleanupRecorder) Cleanup(f func()) {
+	c.cleanups = append(c.cleanups, f)
+}
+
+func (c *cleanupRecorder) Fail() {
+	c.failed = true
+}
+
+func (c *cleanupRecorder) Errorf(format string, args ...interface{}) {
+	c.errors = append(c.errors, fmt.Sprintf(format, args...))
+}
+
+func Test_MitmTransportWithResponseLeakCheck(t *testing.T) {
+	recorder := &cleanupRecorder{TB: t}
+
+	mt := NewMitmTransport().WithResponseLeakCheck(recorder)
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, nil, "[1,2,3]").AnyTimes()
+
+	client := &http.Client{Transport: mt}
+
+	// drained and closed
+	response, err := client.Get("mitm://api.example.com/users")
+	if it.Nil(err) {
+		io.Copy(io.Discard, response.Body)
+		response.Body.Close()
+	}
+	it.Empty(mt.ResponseLeaks())
+
+	// closed without drained
+	response, err = client.Get("mitm://api.example.com/users")
+	if it.Nil(err) {
+		response.Body.Close()
+	}
+
+	// never closed
+	_, err = client.Get("mitm://api.example.com/users")
+	it.Nil(err)
+
+	leaks := mt.ResponseLeaks()
+	if it.Equal(2, len(leaks)) {
+		it.True(leaks[0].Closed)
+		it.False(leaks[0].Drained)
+		it.Contains(leaks[0].String(), "response body of GET https://api.example.com/users never drained, requested at")
+		it.Contains(leaks[0].Stack, "Test_MitmTransportWithResponseLeakCheck")
+		it.Contains(leaks[0].Stack, "body_test.go")
+		it.NotContains(leaks[0].Stack, "net/http.")
+
+		it.False(leaks[1].Closed)
+		it.False(leaks[1].Drained)
+		it.Contains(leaks[1].String(), "never closed and never drained")
+	}
+
+	if it.Equal(1, len(recorder.cleanups)) {
+		recorder.cleanups[0]()
+
+		it.Equal(2, len(recorder.errors))
+		it.Empty(mt.ResponseLeaks())
+	}
+}
+
+func Test_MitmTransportWithResponseLeakCheckUnstub(t *testing.T) {
+	recorder := &cleanupRecorder{TB: t}
+
+	mt := NewMitmTransport().WithResponseLeakCheck(recorder)
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, nil, "[1,2,3]")
+
+	client := &http.Client{Transport: mt}
+
+	// never closed
+	_, err := client.Get("mitm://api.example.com/users")
+	it.Nil(err)
+
+	// NOTE: transport is not stubbed, thus t of WithResponseLeakCheck fails
+	mt.UnstubDefaultTransport()
+	it.True(recorder.failed)
+	it.Empty(mt.ResponseLeaks())
+
+	if it.Equal(1, len(recorder.cleanups)) {
+		recorder.cleanups[0]()
+
+		it.Empty(recorder.errors)
+	}
+}
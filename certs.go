@@ -0,0 +1,256 @@
+package httpmitm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CertificateAuthority is a local CA which mints leaf certificates for intercepted hosts on the fly.
+type CertificateAuthority struct {
+	mux sync.Mutex
+
+	Certificate *x509.Certificate
+	PrivateKey  crypto.Signer
+
+	leafKey crypto.Signer
+	leaves  map[string]*tls.Certificate
+}
+
+// NewCertificateAuthority generates a self-signed CA with ECDSA P-256 key
+func NewCertificateAuthority() (*CertificateAuthority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"httpmitm"},
+			CommonName:   "httpmitm local CA",
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CertificateAuthority{
+		Certificate: cert,
+		PrivateKey:  key,
+		leafKey:     leafKey,
+		leaves:      make(map[string]*tls.Certificate),
+	}, nil
+}
+
+// LoadCertificateAuthority loads CA from certificate and private key files in PEM format
+func LoadCertificateAuthority(certFile, keyFile string) (*CertificateAuthority, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseCertificateAuthority(certPEM, keyPEM)
+}
+
+// ParseCertificateAuthority parses CA from certificate and PKCS #8 private key in PEM format,
+// it's useful for sharing a trusted CA between runs.
+func ParseCertificateAuthority(certPEM, keyPEM []byte) (*CertificateAuthority, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, ErrCertificate
+	}
+
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if !cert.IsCA {
+		return nil, ErrCertificate
+	}
+
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, ErrCertificate
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, ErrCertificate
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CertificateAuthority{
+		Certificate: cert,
+		PrivateKey:  signer,
+		leafKey:     leafKey,
+		leaves:      make(map[string]*tls.Certificate),
+	}, nil
+}
+
+// Leaf returns certificate of host signed by the CA, it's cached by host.
+func (ca *CertificateAuthority) Leaf(host string) (*tls.Certificate, error) {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+
+	ca.mux.Lock()
+	defer ca.mux.Unlock()
+
+	if leaf, ok := ca.leaves[host]; ok {
+		return leaf, nil
+	}
+
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"httpmitm"},
+			CommonName:   host,
+		},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.AddDate(1, 0, 0),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Certificate, ca.leafKey.Public(), ca.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	cert := &tls.Certificate{
+		Certificate: [][]byte{der, ca.Certificate.Raw},
+		PrivateKey:  ca.leafKey,
+		Leaf:        leaf,
+	}
+
+	ca.leaves[host] = cert
+
+	return cert, nil
+}
+
+// Chain returns certificate chain of host signed by the CA, the leaf first and the CA last.
+func (ca *CertificateAuthority) Chain(host string) ([]*x509.Certificate, error) {
+	leaf, err := ca.Leaf(host)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*x509.Certificate{leaf.Leaf, ca.Certificate}, nil
+}
+
+// CertPool returns *x509.CertPool which trusts the CA, it's useful for tls.Config of clients
+func (ca *CertificateAuthority) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Certificate)
+
+	return pool
+}
+
+// CertPEM returns certificate of the CA in PEM format, e.g. for SSL_CERT_FILE of subprocess
+func (ca *CertificateAuthority) CertPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: ca.Certificate.Raw,
+	})
+}
+
+// KeyPEM returns private key of the CA in PKCS #8 PEM format
+func (ca *CertificateAuthority) KeyPEM() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(ca.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	}), nil
+}
+
+// TLSConfig returns *tls.Config of servers which presents leaf certificate of SNI, it falls back to host if SNI is absent.
+func (ca *CertificateAuthority) TLSConfig(host string) *tls.Config {
+	return &tls.Config{
+		NextProtos: []string{"http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name := hello.ServerName
+			if name == "" {
+				name = host
+			}
+
+			return ca.Leaf(name)
+		},
+	}
+}
+
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -0,0 +1,86 @@
+package httpmitm
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_NewCertificateAuthority(t *testing.T) {
+	it := assert.New(t)
+
+	ca, err := NewCertificateAuthority()
+	it.Nil(err)
+	it.True(ca.Certificate.IsCA)
+
+	leaf, err := ca.Leaf("api.example.com:443")
+	it.Nil(err)
+	it.Equal([]string{"api.example.com"}, leaf.Leaf.DNSNames)
+
+	// cached by host
+	cached, _ := ca.Leaf("API.example.com")
+	it.Equal(leaf, cached)
+
+	_, err = leaf.Leaf.Verify(x509.VerifyOptions{
+		DNSName: "api.example.com",
+		Roots:   ca.CertPool(),
+	})
+	it.Nil(err)
+
+	ip, err := ca.Leaf("127.0.0.1")
+	it.Nil(err)
+	it.Equal("127.0.0.1", ip.Leaf.IPAddresses[0].String())
+
+	block, _ := pem.Decode(ca.CertPEM())
+	if it.NotNil(block) {
+		it.Equal("CERTIFICATE", block.Type)
+		it.Equal(ca.Certificate.Raw, block.Bytes)
+	}
+}
+
+func Test_ParseCertificateAuthority(t *testing.T) {
+	it := assert.New(t)
+
+	ca, err := NewCertificateAuthority()
+	it.Nil(err)
+
+	keyPEM, err := ca.KeyPEM()
+	it.Nil(err)
+
+	parsed, err := ParseCertificateAuthority(ca.CertPEM(), keyPEM)
+	if it.Nil(err) {
+		it.Equal(ca.Certificate.Raw, parsed.Certificate.Raw)
+
+		leaf, err := parsed.Leaf("api.example.com")
+		it.Nil(err)
+
+		_, err = leaf.Leaf.Verify(x509.VerifyOptions{
+			DNSName: "api.example.com",
+			Roots:   ca.CertPool(),
+		})
+		it.Nil(err)
+	}
+
+	_, err = ParseCertificateAuthority(nil, keyPEM)
+	it.Equal(ErrCertificate, err)
+
+	_, err = ParseCertificateAuthority(keyPEM, keyPEM)
+	it.NotNil(err)
+}
+
+func Test_CertificateAuthorityChain(t *testing.T) {
+	it := assert.New(t)
+
+	ca, err := NewCertificateAuthority()
+	if !it.Nil(err) {
+		return
+	}
+
+	chain, err := ca.Chain("api.example.com:443")
+	if it.Nil(err) && it.Equal(2, len(chain)) {
+		it.Nil(chain[0].VerifyHostname("api.example.com"))
+		it.Equal(ca.Certificate, chain[1])
+	}
+}
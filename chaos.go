@@ -0,0 +1,436 @@
+package httpmitm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ChaosFault is the kind of fault injected by ChaosPolicy
+type ChaosFault string
+
+// Faults of ChaosPolicy
+const (
+	ChaosServerError ChaosFault = "server_error" // responds with 5xx instead
+	ChaosLatency     ChaosFault = "latency"      // delays response
+	ChaosReset       ChaosFault = "reset"        // fails with connection reset by peer
+	ChaosTruncate    ChaosFault = "truncate"     // fails reading body with io.ErrUnexpectedEOF
+)
+
+var (
+	ErrChaos = errors.New("chaos fault injected")
+
+	defaultChaosStatusCodes = []int{
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+	defaultChaosLatency = 100 * time.Millisecond
+)
+
+// ChaosRule defines probabilities of faults for requests of host and path, a probability is in range [0, 1].
+type ChaosRule struct {
+	Host string // host of requests, empty or * for any
+	Path string // path prefix or pattern of requests, e.g. /users/{id}, empty for any
+
+	ServerError float64
+	Latency     float64
+	Reset       float64
+	Truncate    float64
+
+	StatusCodes []int         // candidates of 5xx, default to 500, 502, 503 and 504
+	MinLatency  time.Duration // default to 100ms
+	MaxLatency  time.Duration // default to MinLatency
+}
+
+func (rule *ChaosRule) match(r *http.Request) bool {
+	if rule.Host != "" && rule.Host != MockWildcard && !strings.EqualFold(rule.Host, r.URL.Host) {
+		return false
+	}
+
+	if rule.Path == "" {
+		return true
+	}
+
+	if IsPathPattern(rule.Path) {
+		_, ok := MatchPathPattern(rule.Path, r.URL.Path)
+
+		return ok
+	}
+
+	return strings.HasPrefix(r.URL.Path, rule.Path)
+}
+
+// ChaosInjection describes a fault injected by ChaosPolicy
+type ChaosInjection struct {
+	Seq     int           `json:"seq"` // sequence of the request, starting from 1
+	Method  string        `json:"method"`
+	URL     string        `json:"url"` // origin url of the request
+	Fault   ChaosFault    `json:"fault"`
+	Status  int           `json:"status,omitempty"`
+	Latency time.Duration `json:"latency,omitempty"`
+	Limit   int64         `json:"limit,omitempty"` // bytes readable before truncated
+}
+
+func (injection *ChaosInjection) String() string {
+	s := "#" + strconv.Itoa(injection.Seq) + " " + injection.Method + " " + injection.URL + " " + string(injection.Fault)
+
+	switch injection.Fault {
+	case ChaosServerError:
+		s += " status=" + strconv.Itoa(injection.Status)
+
+	case ChaosLatency:
+		s += " latency=" + injection.Latency.String()
+
+	case ChaosTruncate:
+		s += " limit=" + strconv.FormatInt(injection.Limit, 10)
+	}
+
+	return s
+}
+
+// ChaosError describes a fault injected by ChaosPolicy, which is reported to observers
+type ChaosError struct {
+	Injection *ChaosInjection
+}
+
+func (e *ChaosError) Error() string {
+	return ErrChaos.Error() + ": " + e.Injection.String()
+}
+
+func (e *ChaosError) Unwrap() error {
+	return ErrChaos
+}
+
+// ChaosPolicy injects faults into successful responses of mocks with probabilities of rules, it's driven by
+// a seeded RNG, thus the same requests in the same order always get the same faults.
+type ChaosPolicy struct {
+	mux sync.Mutex
+
+	seed        int64
+	rand        *rand.Rand
+	rules       []ChaosRule
+	passthrough bool // indicate whether injects faults into passthrough requests?
+
+	seq        int
+	injections []*ChaosInjection
+}
+
+// NewChaosPolicy creates ChaosPolicy with seed of RNG
+func NewChaosPolicy(seed int64) *ChaosPolicy {
+	return &ChaosPolicy{
+		seed: seed,
+		rand: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// WithRule appends rule of faults, the first rule matched by request wins.
+func (c *ChaosPolicy) WithRule(rule ChaosRule) *ChaosPolicy {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.rules = append(c.rules, rule)
+
+	return c
+}
+
+// WithPassthrough injects faults into passthrough requests too, e.g. paused or exceeded expected times.
+func (c *ChaosPolicy) WithPassthrough() *ChaosPolicy {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.passthrough = true
+
+	return c
+}
+
+// Seed returns seed of RNG
+func (c *ChaosPolicy) Seed() int64 {
+	return c.seed
+}
+
+// Injections returns all injected faults, the earliest first.
+func (c *ChaosPolicy) Injections() []*ChaosInjection {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	injections := make([]*ChaosInjection, len(c.injections))
+	copy(injections, c.injections)
+
+	return injections
+}
+
+// Report returns human-readable report of injected faults with seed, one line per fault.
+func (c *ChaosPolicy) Report() string {
+	injections := c.Injections()
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "chaos seed=%d injections=%d\n", c.seed, len(injections))
+	for _, injection := range injections {
+		buf.WriteString(injection.String() + "\n")
+	}
+
+	return buf.String()
+}
+
+// Reset removes injected faults and reseeds RNG
+func (c *ChaosPolicy) Reset() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.rand = rand.New(rand.NewSource(c.seed))
+	c.seq = 0
+	c.injections = nil
+}
+
+// chaosPlan is faults planned for a request, nil for none
+type chaosPlan struct {
+	latency *ChaosInjection
+	fault   *ChaosInjection
+}
+
+// plan decides faults of r, it returns nil if none.
+// NOTE: RNG is drawn in the same order for every matched request to keep faults reproducible.
+func (c *ChaosPolicy) plan(r *http.Request, rawurl string, passthrough bool) *chaosPlan {
+	if c == nil {
+		return nil
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if passthrough && !c.passthrough {
+		return nil
+	}
+
+	var rule *ChaosRule
+	for i := range c.rules {
+		if c.rules[i].match(r) {
+			rule = &c.rules[i]
+			break
+		}
+	}
+	if rule == nil {
+		return nil
+	}
+
+	c.seq++
+
+	inject := func(fault ChaosFault) *ChaosInjection {
+		return &ChaosInjection{
+			Seq:    c.seq,
+			Method: strings.ToUpper(r.Method),
+			URL:    rawurl,
+			Fault:  fault,
+		}
+	}
+
+	rolls := [4]float64{c.rand.Float64(), c.rand.Float64(), c.rand.Float64(), c.rand.Float64()}
+
+	plan := &chaosPlan{}
+	if rolls[0] < rule.Latency {
+		minLatency, maxLatency := rule.MinLatency, rule.MaxLatency
+		if minLatency <= 0 && maxLatency <= 0 {
+			minLatency = defaultChaosLatency
+		}
+		if maxLatency < minLatency {
+			maxLatency = minLatency
+		}
+
+		latency := minLatency
+		if maxLatency > minLatency {
+			latency += time.Duration(c.rand.Int63n(int64(maxLatency - minLatency)))
+		}
+
+		plan.latency = inject(ChaosLatency)
+		plan.latency.Latency = latency
+	}
+
+	switch {
+	case rolls[1] < rule.Reset:
+		plan.fault = inject(ChaosReset)
+
+	case rolls[2] < rule.ServerError:
+		codes := rule.StatusCodes
+		if len(codes) == 0 {
+			codes = defaultChaosStatusCodes
+		}
+
+		plan.fault = inject(ChaosServerError)
+		plan.fault.Status = codes[c.rand.Intn(len(codes))]
+
+	case rolls[3] < rule.Truncate:
+		plan.fault = inject(ChaosTruncate)
+		plan.fault.Limit = c.rand.Int63n(1024)
+	}
+
+	if plan.latency == nil && plan.fault == nil {
+		return nil
+	}
+
+	return plan
+}
+
+// record appends injection applied
+func (c *ChaosPolicy) record(injection *ChaosInjection) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.injections = append(c.injections, injection)
+}
+
+// roundTrip dispatches r to next with faults injected, rawurl is the origin url of r for reporting,
+// and notify is invoked with every fault recorded if not nil.
+// NOTE: Faults except latency are only injected into successful round trips, and 5xx or truncation into 2xx responses.
+func (c *ChaosPolicy) roundTrip(r *http.Request, rawurl string, passthrough bool, next func(*http.Request) (*http.Response, error), notify func(*ChaosInjection)) (*http.Response, error) {
+	plan := c.plan(r, rawurl, passthrough)
+	if plan == nil {
+		return next(r)
+	}
+
+	record := func(injection *ChaosInjection) {
+		c.record(injection)
+
+		if notify != nil {
+			notify(injection)
+		}
+	}
+
+	if plan.latency != nil {
+		record(plan.latency)
+
+		if err := sleepWithRequest(r, plan.latency.Latency); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := next(r)
+	if err != nil || resp == nil || plan.fault == nil || resp.StatusCode == http.StatusSwitchingProtocols {
+		return resp, err
+	}
+
+	fault := plan.fault
+
+	// NOTE: only successful responses are replaced with 5xx or truncated
+	if (fault.Fault == ChaosServerError || fault.Fault == ChaosTruncate) && resp.StatusCode/100 != 2 {
+		return resp, err
+	}
+
+	switch fault.Fault {
+	case ChaosReset:
+		closeBody(resp)
+
+		record(fault)
+
+		return nil, &net.OpError{
+			Op:  "read",
+			Net: "tcp",
+			Err: os.NewSyscallError("read", syscall.ECONNRESET),
+		}
+
+	case ChaosServerError:
+		closeBody(resp)
+
+		body := http.StatusText(fault.Status)
+
+		resp.StatusCode = fault.Status
+		resp.Status = responseStatus(fault.Status)
+		resp.Header = http.Header{
+			"Content-Type":   {"text/plain; charset=utf-8"},
+			"Content-Length": {strconv.Itoa(len(body))},
+		}
+		resp.Body = io.NopCloser(strings.NewReader(body))
+		resp.ContentLength = int64(len(body))
+
+		record(fault)
+
+	case ChaosTruncate:
+		if resp.Body == nil || resp.Body == http.NoBody || r.Method == http.MethodHead {
+			break
+		}
+
+		if resp.ContentLength == 0 {
+			break
+		}
+
+		body := &truncatedBody{
+			ReadCloser: resp.Body,
+		}
+
+		// NOTE: body of unknown length may be shorter than limit, which is recorded only if truncated while reading
+		if resp.ContentLength > 0 {
+			if fault.Limit >= resp.ContentLength {
+				fault.Limit = resp.ContentLength / 2
+			}
+
+			record(fault)
+		} else {
+			body.truncated = func() {
+				record(fault)
+			}
+		}
+		body.limit = fault.Limit
+
+		resp.Body = body
+	}
+
+	return resp, err
+}
+
+// WithChaos injects faults of policy into successful responses of mocks.
+func (mitm *MitmTransport) WithChaos(policy *ChaosPolicy) *MitmTransport {
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	mitm.chaos = policy
+
+	return mitm
+}
+
+// truncatedBody fails with io.ErrUnexpectedEOF after limit bytes read, which is the same as a connection closed
+// before all body sent.
+type truncatedBody struct {
+	io.ReadCloser
+
+	limit int64
+	read  int64
+
+	truncated func() // invoked once if body is longer than limit, nil for checked already
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.read >= b.limit {
+		if b.truncated != nil {
+			var probe [1]byte
+
+			n, err := b.ReadCloser.Read(probe[:])
+			if n == 0 && err != nil {
+				return 0, err
+			}
+
+			b.truncated()
+			b.truncated = nil
+		}
+
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	if int64(len(p)) > b.limit-b.read {
+		p = p[:b.limit-b.read]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+
+	return n, err
+}
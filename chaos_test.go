@@ -0,0 +1,224 @@
+package httpmitm
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+)
+
+func Test_ChaosPolicy(t *testing.T) {
+	it := assert.New(t)
+
+	issue := func(policy *ChaosPolicy) []int {
+		mt := NewMitmTransport().WithChaos(policy)
+		mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, nil, "[]").AnyTimes()
+
+		client := &http.Client{Transport: mt}
+
+		var codes []int
+		for i := 0; i < 20; i++ {
+			response, err := client.Get("mitm://api.example.com/users")
+			if !it.Nil(err) {
+				return nil
+			}
+			response.Body.Close()
+
+			codes = append(codes, response.StatusCode)
+		}
+
+		return codes
+	}
+
+	rule := ChaosRule{
+		Host:        "api.example.com",
+		ServerError: 0.5,
+	}
+
+	policy := NewChaosPolicy(42).WithRule(rule)
+
+	codes := issue(policy)
+	it.Contains(codes, 200)
+	it.Contains(codes, 503)
+	it.Equal(int64(42), policy.Seed())
+
+	// reproducible with the same seed
+	other := NewChaosPolicy(42).WithRule(rule)
+	it.Equal(codes, issue(other))
+	it.Equal(policy.Report(), other.Report())
+
+	injections := policy.Injections()
+	if it.NotEmpty(injections) {
+		it.Equal(ChaosServerError, injections[0].Fault)
+		it.Equal("https://api.example.com/users", injections[0].URL)
+		it.Contains(policy.Report(), "GET https://api.example.com/users server_error status=")
+	}
+
+	policy.Reset()
+	it.Empty(policy.Injections())
+	it.Equal(codes, issue(policy))
+}
+
+func Test_ChaosPolicyWithFaults(t *testing.T) {
+	policy := NewChaosPolicy(1).
+		WithRule(ChaosRule{Path: "/reset", Reset: 1}).
+		WithRule(ChaosRule{Path: "/users/{id}", Truncate: 1}).
+		WithRule(ChaosRule{Path: "/slow", Latency: 1, MinLatency: 10 * time.Millisecond, MaxLatency: 20 * time.Millisecond})
+
+	mt := NewMitmTransport().WithChaos(policy)
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/reset").WithResponse(200, nil, "OK")
+	mt.MockRequest("GET", "https://api.example.com/users/{id}").WithResponse(200, nil, strings.Repeat("x", 100))
+	mt.MockRequest("GET", "https://api.example.com/slow").WithResponse(200, nil, "OK")
+	mt.MockRequest("GET", "https://api.example.com/fail").WithResponser(NewTimeoutResponder())
+
+	client := &http.Client{Transport: mt}
+
+	_, err := client.Get("mitm://api.example.com/reset")
+	it.True(errors.Is(err, syscall.ECONNRESET))
+
+	response, err := client.Get("mitm://api.example.com/users/1")
+	if it.Nil(err) {
+		data, err := io.ReadAll(response.Body)
+		response.Body.Close()
+
+		it.Equal(io.ErrUnexpectedEOF, err)
+		it.True(len(data) < 100)
+	}
+
+	start := time.Now()
+
+	response, err = client.Get("mitm://api.example.com/slow")
+	if it.Nil(err) {
+		response.Body.Close()
+
+		it.True(time.Since(start) >= 10*time.Millisecond)
+	}
+
+	// no rule matched
+	_, err = client.Get("mitm://api.example.com/fail")
+	it.True(errors.Is(err, ErrTimeout))
+
+	injections := policy.Injections()
+	if it.Equal(3, len(injections)) {
+		it.Equal(ChaosReset, injections[0].Fault)
+		it.Equal(ChaosTruncate, injections[1].Fault)
+		it.Equal("https://api.example.com/users/1", injections[1].URL)
+		it.Equal(ChaosLatency, injections[2].Fault)
+		it.True(injections[2].Latency >= 10*time.Millisecond)
+		it.True(injections[2].Latency < 20*time.Millisecond)
+	}
+}
+
+func Test_ChaosPolicyWithPassthrough(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer srv.Close()
+
+	it := assert.New(t)
+
+	for _, passthrough := range []bool{false, true} {
+		policy := NewChaosPolicy(1).WithRule(ChaosRule{ServerError: 1})
+		if passthrough {
+			policy.WithPassthrough()
+		}
+
+		mt := NewMitmTransport().WithChaos(policy)
+		mt.MockRequest("GET", srv.URL).WithResponse(200, nil, "")
+		mt.SetPaused(true)
+
+		response, err := mt.RoundTrip(httptest.NewRequest("GET", strings.Replace(srv.URL, "http", MockScheme, 1), nil))
+		if it.Nil(err) {
+			response.Body.Close()
+
+			if passthrough {
+				it.Equal(http.StatusInternalServerError/100, response.StatusCode/100)
+				it.Equal(1, len(policy.Injections()))
+			} else {
+				it.Equal(200, response.StatusCode)
+				it.Empty(policy.Injections())
+			}
+		}
+	}
+}
+
+func Test_ChaosPolicyWithUnsuccessfulResponse(t *testing.T) {
+	policy := NewChaosPolicy(1).
+		WithRule(ChaosRule{Path: "/missing", ServerError: 1}).
+		WithRule(ChaosRule{Path: "/stream", Truncate: 1})
+
+	mt := NewMitmTransport().WithChaos(policy)
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/missing").WithResponse(404, nil, "Not Found")
+	mt.MockRequest("GET", "https://api.example.com/stream").WithResponser(NewChunkedResponder(200, nil, 0, []byte("OK")))
+
+	client := &http.Client{Transport: mt}
+
+	response, err := client.Get("mitm://api.example.com/missing")
+	if it.Nil(err) {
+		response.Body.Close()
+
+		it.Equal(404, response.StatusCode)
+	}
+
+	// body of unknown length shorter than limit is never truncated
+	response, err = client.Get("mitm://api.example.com/stream")
+	if it.Nil(err) {
+		data, err := io.ReadAll(response.Body)
+		response.Body.Close()
+
+		it.Nil(err)
+		it.Equal("OK", string(data))
+	}
+
+	it.Empty(policy.Injections())
+}
+
+func Test_ChaosPolicyObserve(t *testing.T) {
+	policy := NewChaosPolicy(1).
+		WithRule(ChaosRule{Path: "/reset", Reset: 1}).
+		WithRule(ChaosRule{Path: "/users", ServerError: 1, StatusCodes: []int{503}})
+
+	observer := &recordingObserver{}
+
+	mt := NewMitmTransport().WithChaos(policy).Observe(observer)
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/reset").WithResponse(200, nil, "OK")
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, nil, "[]")
+
+	client := &http.Client{Transport: mt}
+
+	_, err := client.Get("mitm://api.example.com/reset")
+	it.True(errors.Is(err, syscall.ECONNRESET))
+	it.Equal([]string{
+		"request GET mitm://api.example.com/reset",
+		"matched GET https://api.example.com/reset",
+		"error https://api.example.com/reset " + ErrChaos.Error() + ": #1 GET https://api.example.com/reset reset",
+	}, observer.Events())
+
+	response, err := client.Get("mitm://api.example.com/users")
+	if it.Nil(err) {
+		response.Body.Close()
+
+		it.Equal(503, response.StatusCode)
+	}
+	it.Equal([]string{
+		"request GET mitm://api.example.com/users",
+		"matched GET https://api.example.com/users",
+		"error https://api.example.com/users " + ErrChaos.Error() + ": #2 GET https://api.example.com/users server_error status=503",
+		"response 503 Service Unavailable",
+	}, observer.Events())
+}
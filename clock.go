@@ -0,0 +1,193 @@
+package httpmitm
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock provides time of time-dependent mocks, e.g. delays, rate limits, Date header and history of requests.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// RealClock is Clock of wall time, it's the default.
+type RealClock struct{}
+
+// Now implements Clock
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// After implements Clock
+func (RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// FakeClock is Clock controlled by Advance, thus tests of retry, backoff, caching and expiry run instantly
+// and deterministically.
+// NOTE: A delay of mocks blocks until the clock advanced over it, apply WithAutoAdvance for advancing by the delay instead.
+type FakeClock struct {
+	mux sync.Mutex
+
+	now     time.Time
+	auto    bool
+	waiters []*fakeWaiter
+}
+
+// clockStopper is implemented by Clock whose delays can be removed before fired, e.g. FakeClock
+type clockStopper interface {
+	Stop(ch <-chan time.Time) bool
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewFakeClock creates FakeClock starting at now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{
+		now: now,
+	}
+}
+
+// WithAutoAdvance advances the clock by delays of After immediately, instead of blocking until advanced.
+func (c *FakeClock) WithAutoAdvance() *FakeClock {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.auto = true
+
+	return c
+}
+
+// Now implements Clock
+func (c *FakeClock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.now
+}
+
+// After implements Clock, the returned channel receives time after the clock advanced over d.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	ch := make(chan time.Time, 1)
+
+	deadline := c.now.Add(d)
+	if c.auto && d > 0 {
+		c.advance(d)
+	}
+
+	if !deadline.After(c.now) {
+		ch <- c.now
+
+		return ch
+	}
+
+	c.waiters = append(c.waiters, &fakeWaiter{
+		deadline: deadline,
+		ch:       ch,
+	})
+
+	return ch
+}
+
+// Stop removes the delay of ch returned by After, it returns false if the delay fired or stopped already.
+func (c *FakeClock) Stop(ch <-chan time.Time) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for i, waiter := range c.waiters {
+		if waiter.ch == ch {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// Advance moves the clock forward by d, and fires all delays expired in order.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.advance(d)
+}
+
+// Waiters returns count of delays waiting for the clock advanced, e.g. for synchronizing with requests in flight.
+func (c *FakeClock) Waiters() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return len(c.waiters)
+}
+
+func (c *FakeClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+
+	sort.SliceStable(c.waiters, func(i, j int) bool {
+		return c.waiters[i].deadline.Before(c.waiters[j].deadline)
+	})
+
+	n := 0
+	for _, waiter := range c.waiters {
+		if waiter.deadline.After(c.now) {
+			break
+		}
+
+		waiter.ch <- c.now
+		n++
+	}
+
+	c.waiters = c.waiters[n:]
+}
+
+type clockContextKey struct{}
+
+// RequestClock returns Clock of MitmTransport handling r, e.g. for Expires and Last-Modified headers of callee responders.
+// It's RealClock for requests not issued through MitmTransport.
+func RequestClock(r *http.Request) Clock {
+	if r != nil {
+		if clock, ok := r.Context().Value(clockContextKey{}).(Clock); ok {
+			return clock
+		}
+	}
+
+	return RealClock{}
+}
+
+// withClock returns shallow copy of r with clock
+func withClock(r *http.Request, clock Clock) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), clockContextKey{}, clock))
+}
+
+// WithClock applies clock to all time-dependent mocks, e.g. delays, rate limits, Date header and history of requests.
+func (mitm *MitmTransport) WithClock(clock Clock) *MitmTransport {
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	mitm.clock = clock
+
+	return mitm
+}
+
+// Clock returns clock of mocks, it's RealClock by default.
+func (mitm *MitmTransport) Clock() Clock {
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	if mitm.clock == nil {
+		return RealClock{}
+	}
+
+	return mitm.clock
+}
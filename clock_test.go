@@ -0,0 +1,225 @@
+package httpmitm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+)
+
+func Test_FakeClock(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+
+	clock := NewFakeClock(start)
+
+	it := assert.New(t)
+
+	later := clock.After(2 * time.Second)
+	sooner := clock.After(time.Second)
+	it.Equal(2, clock.Waiters())
+
+	select {
+	case <-clock.After(0):
+	default:
+		it.Fail("expected expired delay fired")
+	}
+
+	clock.Advance(time.Second)
+	it.Equal(start.Add(time.Second), <-sooner)
+	it.Equal(1, clock.Waiters())
+
+	select {
+	case <-later:
+		it.Fail("expected delay not fired")
+	default:
+	}
+
+	clock.Advance(time.Minute)
+	it.Equal(start.Add(time.Minute+time.Second), <-later)
+	it.Equal(0, clock.Waiters())
+	it.Equal(start.Add(time.Minute+time.Second), clock.Now())
+
+	// stopped
+	stopped := clock.After(time.Second)
+	it.Equal(1, clock.Waiters())
+	it.True(clock.Stop(stopped))
+	it.False(clock.Stop(stopped))
+	it.Equal(0, clock.Waiters())
+
+	// auto advance
+	clock = NewFakeClock(start).WithAutoAdvance()
+
+	<-clock.After(time.Hour)
+	it.Equal(start.Add(time.Hour), clock.Now())
+	it.Equal(0, clock.Waiters())
+}
+
+func Test_MitmTransportWithClock(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+
+	clock := NewFakeClock(start)
+
+	mt := NewMitmTransport().WithClock(clock)
+
+	it := assert.New(t)
+	it.Equal(clock, mt.Clock())
+	it.Equal(RealClock{}, NewMitmTransport().Clock())
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponser(NewDelayResponder(NewResponder(200, nil, "OK"), time.Second))
+	mt.MockRequest("GET", "https://api.example.com/token").WithCalleeResponse(func(r *http.Request) (int, http.Header, io.Reader, error) {
+		header := http.Header{}
+		header.Set("Expires", RequestClock(r).Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+
+		return 200, header, strings.NewReader("token"), nil
+	})
+
+	client := &http.Client{Transport: mt}
+
+	done := make(chan *http.Response, 1)
+	go func() {
+		response, err := client.Get("mitm://api.example.com/users")
+		if it.Nil(err) {
+			response.Body.Close()
+		}
+
+		done <- response
+	}()
+
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Second)
+
+	response := <-done
+	if it.NotNil(response) {
+		it.Equal(200, response.StatusCode)
+		it.Equal("Tue, 14 Nov 2023 22:13:21 GMT", response.Header.Get("Date"))
+	}
+
+	response, err := client.Get("mitm://api.example.com/token")
+	if it.Nil(err) {
+		response.Body.Close()
+
+		it.Equal("Tue, 14 Nov 2023 23:13:21 GMT", response.Header.Get("Expires"))
+	}
+
+	history := mt.History()
+	if it.Equal(2, len(history)) {
+		it.Equal(start, history[0].Time)
+		it.Equal(time.Second, history[0].Duration)
+		it.Equal(start.Add(time.Second), history[1].Time)
+		it.Equal(time.Duration(0), history[1].Duration)
+	}
+}
+
+func Test_MitmTransportWithClockOfCanceledRequest(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+
+	mt := NewMitmTransport().WithClock(clock)
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponser(NewDelayResponder(NewResponder(200, nil, "OK"), time.Second))
+
+	client := &http.Client{Transport: mt}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	request, _ := http.NewRequestWithContext(ctx, "GET", "mitm://api.example.com/users", nil)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Do(request)
+
+		done <- err
+	}()
+
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	it.True(errors.Is(<-done, context.Canceled))
+	it.Equal(0, clock.Waiters())
+}
+
+func Test_MitmTransportWithAutoAdvanceClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0)).WithAutoAdvance()
+
+	mt := NewMitmTransport().WithClock(clock)
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/events").WithChunkedResponse(200, nil, time.Minute, []byte("a"), []byte("b")).WithTraceTimings(TraceTimings{FirstByte: time.Minute})
+
+	client := &http.Client{Transport: mt}
+
+	start := time.Now()
+
+	request, _ := http.NewRequest("GET", "mitm://api.example.com/events", nil)
+	request = request.WithContext(httptrace.WithClientTrace(request.Context(), &httptrace.ClientTrace{}))
+
+	response, err := client.Do(request)
+	if it.Nil(err) {
+		data, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+
+		it.Equal("ab", string(data))
+	}
+
+	it.True(time.Since(start) < time.Minute)
+	it.Equal(time.Unix(1700000000, 0).Add(2*time.Minute), clock.Now())
+}
+
+func Test_MitmTransportWithClockOfConcurrentRequests(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+
+	mt := NewMitmTransport().WithClock(clock)
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponser(NewDelayResponder(NewResponder(200, nil, "OK"), time.Second)).AnyTimes()
+
+	client := &http.Client{Transport: mt}
+
+	done := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			response, err := client.Get("mitm://api.example.com/users")
+			if err != nil {
+				done <- 0
+				return
+			}
+			response.Body.Close()
+
+			done <- response.StatusCode
+		}()
+	}
+
+	// requests of the same mock sleep concurrently
+	deadline := time.Now().Add(time.Second)
+	for clock.Waiters() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	it.Equal(2, clock.Waiters())
+
+	// NOTE: advance until all done, which never hangs if requests are serialized
+	for received := 0; received < 2 && time.Now().Before(deadline.Add(time.Second)); {
+		clock.Advance(time.Second)
+
+		select {
+		case code := <-done:
+			it.Equal(200, code)
+
+			received++
+
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
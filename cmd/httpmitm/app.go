@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dolab/httpmitm"
+)
+
+// config defines options of command line
+type config struct {
+	addr        string
+	proxyAddr   string
+	adminAddr   string
+	defaultHost string
+	record      string
+	caCert      string
+	caKey       string
+	watch       time.Duration
+	paths       []string
+}
+
+// state is a snapshot of loaded definitions, which is swapped on reload
+type state struct {
+	mitm   *httpmitm.MitmTransport
+	server *httpmitm.MitmHandler
+	proxy  *httpmitm.MitmProxyHandler
+	admin  *httpmitm.AdminHandler
+}
+
+// close releases connections of the state, e.g. CONNECT tunnels of proxy
+func (s *state) close() {
+	if s.proxy != nil {
+		s.proxy.Close()
+	}
+}
+
+// app serves mock definitions with hot reload
+type app struct {
+	cfg    config
+	logger *log.Logger
+
+	ca       *httpmitm.CertificateAuthority
+	recorder *httpmitm.Recorder
+	current  atomic.Pointer[state]
+
+	mux    sync.Mutex
+	stamps map[string]string
+}
+
+func newApp(cfg config, logger *log.Logger) (*app, error) {
+	a := &app{
+		cfg:    cfg,
+		logger: logger,
+	}
+
+	if cfg.proxyAddr != "" {
+		ca, err := loadCA(cfg.caCert, cfg.caKey)
+		if err != nil {
+			return nil, err
+		}
+
+		a.ca = ca
+	}
+
+	if cfg.record != "" {
+		a.recorder = httpmitm.NewRecorder(&http.Transport{
+			Proxy:                 nil,
+			DialContext:           (&net.Dialer{Timeout: 30 * time.Second}).DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		})
+	}
+
+	if err := a.reload(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// reload loads all definitions and swaps current state, the current state is kept if any definition is invalid.
+func (a *app) reload() error {
+	stamps, err := a.stat()
+	if err != nil {
+		return err
+	}
+
+	mt := httpmitm.NewMitmTransport()
+	if len(a.cfg.paths) > 0 {
+		if err := mt.LoadDefinitions(a.cfg.paths...); err != nil {
+			return err
+		}
+	}
+
+	next := &state{
+		mitm:   mt,
+		server: mt.Handler().WithDefaultHost(a.cfg.defaultHost),
+		admin:  mt.AdminHandler(),
+	}
+
+	if a.ca != nil {
+		next.proxy, err = mt.ProxyHandler(a.ca)
+		if err != nil {
+			return err
+		}
+
+		next.proxy.WithMiddleware(a.logging)
+	}
+
+	if a.recorder != nil {
+		passthrough := &recordingTransport{
+			recorder: a.recorder,
+			filename: a.cfg.record,
+			logger:   a.logger,
+		}
+
+		next.server.WithPassthrough(passthrough)
+		if next.proxy != nil {
+			next.proxy.WithPassthrough(passthrough)
+		}
+	}
+
+	// NOTE: connections of previous state are served by stale mocks, which are closed for reconnecting
+	if prev := a.current.Swap(next); prev != nil {
+		prev.close()
+	}
+
+	a.mux.Lock()
+	a.stamps = stamps
+	a.mux.Unlock()
+
+	return nil
+}
+
+// watch reloads definitions on file changes until ctx done
+func (a *app) watch(ctx context.Context) {
+	if a.cfg.watch <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(a.cfg.watch)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			if !a.changed() {
+				continue
+			}
+
+			if err := a.reload(); err != nil {
+				a.logger.Printf("reload: %v", err)
+
+				// NOTE: avoid reporting the same error until next change
+				if stamps, err := a.stat(); err == nil {
+					a.mux.Lock()
+					a.stamps = stamps
+					a.mux.Unlock()
+				}
+
+				continue
+			}
+
+			a.logger.Printf("reloaded definitions of %s", strings.Join(a.cfg.paths, ", "))
+		}
+	}
+}
+
+// changed returns true if any definition file is added, removed or modified
+func (a *app) changed() bool {
+	stamps, err := a.stat()
+	if err != nil {
+		return true
+	}
+
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	if len(stamps) != len(a.stamps) {
+		return true
+	}
+
+	for name, stamp := range stamps {
+		if a.stamps[name] != stamp {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stat returns modification stamps of all files within paths
+func (a *app) stat() (map[string]string, error) {
+	stamps := map[string]string{}
+
+	// NOTE: cassette is saved after each recorded exchange, which must not reset state of mocks
+	cassette := ""
+	if a.cfg.record != "" {
+		cassette, _ = filepath.Abs(a.cfg.record)
+	}
+
+	for _, path := range a.cfg.paths {
+		err := filepath.Walk(path, func(name string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+
+			if abs, _ := filepath.Abs(name); abs == cassette {
+				return nil
+			}
+
+			stamps[name] = fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stamps, nil
+}
+
+// serverHandler returns http.Handler of mock server
+func (a *app) serverHandler() http.Handler {
+	return a.logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.current.Load().server.ServeHTTP(w, r)
+	}))
+}
+
+// proxyHandler returns http.Handler of forward proxy
+func (a *app) proxyHandler() http.Handler {
+	return a.logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.current.Load().proxy.ServeHTTP(w, r)
+	}))
+}
+
+// adminHandler returns http.Handler of admin API
+// NOTE: Mocks created by admin API are dropped on reload.
+func (a *app) adminHandler() http.Handler {
+	return a.logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.current.Load().admin.ServeHTTP(w, r)
+	}))
+}
+
+// logging prints a line for each request with status, size and duration
+func (a *app) logging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		lw := &logWriter{
+			ResponseWriter: w,
+			status:         http.StatusOK,
+		}
+
+		next.ServeHTTP(lw, r)
+
+		rawurl := r.URL.String()
+		switch {
+		case r.Method == http.MethodConnect:
+			rawurl = r.Host
+
+		case !r.URL.IsAbs():
+			scheme := "http"
+			if r.TLS != nil {
+				scheme = "https"
+			}
+
+			rawurl = scheme + "://" + r.Host + r.URL.RequestURI()
+		}
+
+		a.logger.Printf("%s %s %d %dB %s", r.Method, rawurl, lw.status, lw.size, time.Since(start).Round(time.Microsecond))
+	})
+}
+
+// recordingTransport records unseen traffic and saves cassette after each exchange
+type recordingTransport struct {
+	recorder *httpmitm.Recorder
+	filename string
+	logger   *log.Logger
+}
+
+func (rt *recordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := rt.recorder.RoundTrip(r)
+	if err != nil {
+		return resp, err
+	}
+
+	if err := rt.recorder.Save(rt.filename); err != nil {
+		rt.logger.Printf("record: %v", err)
+	}
+
+	return resp, nil
+}
+
+// logWriter captures status and size of response
+type logWriter struct {
+	http.ResponseWriter
+
+	status int
+	size   int64
+}
+
+func (w *logWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.size += int64(n)
+
+	return n, err
+}
+
+func (w *logWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *logWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	return hijacker.Hijack()
+}
+
+// loadCA loads CA from files, it generates and saves a new one if files not exist.
+// An ephemeral CA is generated if files are not given.
+func loadCA(certFile, keyFile string) (*httpmitm.CertificateAuthority, error) {
+	if certFile == "" || keyFile == "" {
+		return httpmitm.NewCertificateAuthority()
+	}
+
+	ca, err := httpmitm.LoadCertificateAuthority(certFile, keyFile)
+	if !errors.Is(err, os.ErrNotExist) {
+		return ca, err
+	}
+
+	ca, err = httpmitm.NewCertificateAuthority()
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := ca.KeyPEM()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(certFile, ca.CertPEM(), 0644); err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return nil, err
+	}
+
+	return ca, nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+)
+
+func writeDefinition(t *testing.T, filename, body string) {
+	data := `
+mocks:
+  - method: GET
+    url: https://api.example.com/hello
+    times: any
+    response:
+      status: 200
+      body: ` + body + `
+`
+
+	if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_AppReload(t *testing.T) {
+	it := assert.New(t)
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "hello.yaml")
+	writeDefinition(t, filename, "v1")
+
+	a, err := newApp(config{
+		addr:  ":0",
+		paths: []string{dir},
+	}, log.New(io.Discard, "", 0))
+	if !it.Nil(err) {
+		return
+	}
+
+	server := httptest.NewServer(a.serverHandler())
+	defer server.Close()
+
+	get := func() string {
+		response, err := http.Get(server.URL + "/hello")
+		if err != nil {
+			return err.Error()
+		}
+
+		b, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+
+		return string(b)
+	}
+
+	it.Equal("v1", get())
+	it.False(a.changed())
+
+	// modify definitions
+	writeDefinition(t, filename, "v2-updated")
+	it.True(a.changed())
+	it.Nil(a.reload())
+	it.Equal("v2-updated", get())
+
+	// admin API of current state
+	admin := httptest.NewRecorder()
+	a.adminHandler().ServeHTTP(admin, httptest.NewRequest("GET", "/status", nil))
+	it.Equal(200, admin.Code)
+	it.Contains(admin.Body.String(), `"mocks":1`)
+
+	// invalid definitions keep current state
+	os.WriteFile(filename, []byte("mocks:\n  - method: GET\n"), 0644)
+	it.NotNil(a.reload())
+	it.Equal("v2-updated", get())
+}
+
+func Test_AppReloadWithProxy(t *testing.T) {
+	it := assert.New(t)
+
+	dir := t.TempDir()
+	writeDefinition(t, filepath.Join(dir, "hello.yaml"), "v1")
+
+	a, err := newApp(config{
+		proxyAddr: ":0",
+		paths:     []string{dir},
+	}, log.New(io.Discard, "", 0))
+	if !it.Nil(err) {
+		return
+	}
+
+	proxy := httptest.NewServer(a.proxyHandler())
+	defer proxy.Close()
+
+	conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+	if !it.Nil(err) {
+		return
+	}
+	defer conn.Close()
+
+	// intercepted tunnel of mocked host
+	io.WriteString(conn, "CONNECT api.example.com:443 HTTP/1.1\r\nHost: api.example.com:443\r\n\r\n")
+
+	response, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if !it.Nil(err) {
+		return
+	}
+	it.Equal(200, response.StatusCode)
+
+	// tunnel of previous state is closed after reload
+	it.Nil(a.reload())
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	_, err = conn.Read(make([]byte, 1))
+	it.NotNil(err)
+	it.False(errors.Is(err, os.ErrDeadlineExceeded))
+}
+
+func Test_AppRecord(t *testing.T) {
+	it := assert.New(t)
+
+	invoked := 0
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		invoked++
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("origin"))
+	}))
+	defer origin.Close()
+
+	dir := t.TempDir()
+	cassette := filepath.Join(dir, "cassette.yaml")
+
+	a, err := newApp(config{
+		proxyAddr: ":0",
+		record:    cassette,
+		paths:     []string{dir},
+	}, log.New(io.Discard, "", 0))
+	if !it.Nil(err) {
+		return
+	}
+
+	proxy := httptest.NewServer(a.proxyHandler())
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyURL(proxyURL),
+		},
+	}
+
+	get := func() string {
+		response, err := client.Get(origin.URL + "/hello")
+		if err != nil {
+			return err.Error()
+		}
+
+		b, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+
+		return string(b)
+	}
+
+	// record unseen traffic
+	it.Equal("origin", get())
+	it.Equal(1, invoked)
+
+	data, err := os.ReadFile(cassette)
+	it.Nil(err)
+	it.Contains(string(data), origin.URL+"/hello")
+
+	// saving cassette never triggers reload
+	it.False(a.changed())
+
+	// replay recorded traffic after reload
+	it.Nil(a.reload())
+
+	it.Equal("origin", get())
+	it.Equal(1, invoked)
+}
+
+func Test_AppLogging(t *testing.T) {
+	it := assert.New(t)
+
+	dir := t.TempDir()
+	writeDefinition(t, filepath.Join(dir, "hello.yaml"), "v1")
+
+	var logs bytes.Buffer
+
+	a, err := newApp(config{
+		addr:        ":0",
+		defaultHost: "api.example.com",
+		paths:       []string{dir},
+	}, log.New(&logs, "", 0))
+	if !it.Nil(err) {
+		return
+	}
+
+	recorder := httptest.NewRecorder()
+	a.serverHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "http://localhost:8080/hello", nil))
+	it.Equal(200, recorder.Code)
+	it.True(strings.HasPrefix(logs.String(), "GET http://localhost:8080/hello 200 2B "))
+}
+
+func Test_LoadCA(t *testing.T) {
+	it := assert.New(t)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "ca.pem")
+	keyFile := filepath.Join(dir, "ca-key.pem")
+
+	ca, err := loadCA(certFile, keyFile)
+	it.Nil(err)
+
+	loaded, err := loadCA(certFile, keyFile)
+	if it.Nil(err) {
+		it.Equal(ca.Certificate.Raw, loaded.Certificate.Raw)
+	}
+}
+
+func Test_ParseFlags(t *testing.T) {
+	it := assert.New(t)
+
+	cfg, err := parseFlags([]string{"-proxy", ":8888", "-watch", "2s", "testdata"}, io.Discard)
+	it.Nil(err)
+	it.Equal(":8080", cfg.addr)
+	it.Equal(":8888", cfg.proxyAddr)
+	it.Equal(2*time.Second, cfg.watch)
+	it.Equal([]string{"testdata"}, cfg.paths)
+
+	_, err = parseFlags([]string{"-addr", ""}, io.Discard)
+	it.NotNil(err)
+}
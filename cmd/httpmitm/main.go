@@ -0,0 +1,150 @@
+// Command httpmitm serves mock definitions over HTTP, and optionally as a forward proxy, e.g.
+//
+//	httpmitm -addr :8080 -proxy :8888 -admin :8081 -record testdata/cassette.yaml testdata/mocks
+//
+// Definitions are reloaded on file changes, and unseen traffic is passed through to origin and recorded as
+// definitions if -record given. Requests of proxy are intercepted with a local CA, which is persisted with
+// -ca-cert and -ca-key for trusting by clients.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	logger := log.New(os.Stderr, "[httpmitm] ", log.LstdFlags)
+
+	cfg, err := parseFlags(os.Args[1:], os.Stderr)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, cfg, logger); err != nil {
+		logger.Fatal(err)
+	}
+}
+
+func parseFlags(args []string, output io.Writer) (config, error) {
+	var cfg config
+
+	flags := flag.NewFlagSet("httpmitm", flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.Usage = func() {
+		fmt.Fprintf(output, "Usage: httpmitm [options] <definition files or directories>...\n\nOptions:\n")
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&cfg.addr, "addr", ":8080", "listen address of mock server, empty for disabled")
+	flags.StringVar(&cfg.proxyAddr, "proxy", "", "listen address of forward proxy, empty for disabled")
+	flags.StringVar(&cfg.adminAddr, "admin", "", "listen address of admin API, empty for disabled")
+	flags.StringVar(&cfg.defaultHost, "host", "", "default virtual host of mock server for requests whose Host header is not mocked")
+	flags.StringVar(&cfg.record, "record", "", "cassette file for recording unseen traffic passed through to origin")
+	flags.StringVar(&cfg.caCert, "ca-cert", "", "certificate file of proxy CA in PEM format, generated if not exist")
+	flags.StringVar(&cfg.caKey, "ca-key", "", "private key file of proxy CA in PEM format, generated if not exist")
+	flags.DurationVar(&cfg.watch, "watch", time.Second, "interval of checking definition changes, 0 for disabled")
+
+	if err := flags.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	cfg.paths = flags.Args()
+
+	if cfg.addr == "" && cfg.proxyAddr == "" {
+		err := errors.New("either -addr or -proxy is required")
+
+		fmt.Fprintln(output, err)
+		flags.Usage()
+
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+func run(ctx context.Context, cfg config, logger *log.Logger) error {
+	a, err := newApp(cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	go a.watch(ctx)
+
+	var servers []*http.Server
+
+	errs := make(chan error, 3)
+
+	serve := func(name, addr string, handler http.Handler) error {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+
+		server := &http.Server{
+			Handler:           handler,
+			ReadHeaderTimeout: 30 * time.Second,
+		}
+		servers = append(servers, server)
+
+		logger.Printf("%s listening on %s", name, listener.Addr())
+
+		go func() {
+			if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+				errs <- err
+			}
+		}()
+
+		return nil
+	}
+
+	if cfg.addr != "" {
+		if err := serve("mock server", cfg.addr, a.serverHandler()); err != nil {
+			return err
+		}
+	}
+
+	if cfg.proxyAddr != "" {
+		if err := serve("forward proxy", cfg.proxyAddr, a.proxyHandler()); err != nil {
+			return err
+		}
+	}
+
+	if cfg.adminAddr != "" {
+		if err := serve("admin API", cfg.adminAddr, a.adminHandler()); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, server := range servers {
+		server.Shutdown(shutdownCtx)
+	}
+
+	a.current.Load().close()
+
+	return err
+}
@@ -0,0 +1,533 @@
+package httpmitm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrContract = errors.New("contract violation")
+)
+
+// ContractError describes violations of request or response against contract
+type ContractError struct {
+	Method     string
+	URL        string
+	Violations []*SchemaViolation
+}
+
+func (e *ContractError) Error() string {
+	lines := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		lines = append(lines, DefaultLeaddingSpace+violation.String())
+	}
+
+	return ErrContract.Error() + " of " + e.Method + " " + e.URL + ":\n" + strings.Join(lines, "\n")
+}
+
+func (e *ContractError) Unwrap() error {
+	return ErrContract
+}
+
+// Contract validates requests and responses against operations of OpenAPI document
+type Contract struct {
+	api       *OpenAPI
+	basePath  string
+	hosts     []string // nil for any host
+	responses bool
+}
+
+// NewContract creates *Contract of OpenAPI document, the path of the first server url is used as base path.
+// NOTE: Only requests to hosts of servers are validated, any host is validated if there is relative server url.
+func NewContract(api *OpenAPI) *Contract {
+	contract := &Contract{
+		api: api,
+	}
+
+	for i, rawurl := range api.ServerURLs() {
+		urlobj, err := url.Parse(rawurl)
+		if err != nil {
+			continue
+		}
+
+		if i == 0 {
+			contract.basePath = strings.TrimRight(urlobj.Path, "/")
+		}
+
+		if urlobj.Host == "" {
+			contract.hosts = nil
+			break
+		}
+
+		contract.hosts = append(contract.hosts, strings.ToLower(urlobj.Host))
+	}
+
+	return contract
+}
+
+// WithBaseURL changes base path of operations with path of rawurl, and scopes the contract to host of rawurl if present.
+func (c *Contract) WithBaseURL(rawurl string) *Contract {
+	if urlobj, err := url.Parse(rawurl); err == nil {
+		c.basePath = strings.TrimRight(urlobj.Path, "/")
+
+		if urlobj.Host != "" {
+			c.hosts = []string{strings.ToLower(urlobj.Host)}
+		}
+	}
+
+	return c
+}
+
+// WithResponses enables validation of responses, it's useful for catching stale fixtures
+func (c *Contract) WithResponses() *Contract {
+	c.responses = true
+
+	return c
+}
+
+// Covers returns true if host of the request is one of servers of the contract
+func (c *Contract) Covers(r *http.Request) bool {
+	if c.hosts == nil {
+		return true
+	}
+
+	for _, host := range c.hosts {
+		if strings.EqualFold(r.URL.Host, host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Find returns operation and its path params related to the request, nil for undocumented request
+func (c *Contract) Find(r *http.Request) (*OpenAPIOperation, map[string]string) {
+	if !c.Covers(r) {
+		return nil, nil
+	}
+
+	// NOTE: base path of /v1 never matches /v10
+	urlpath, ok := strings.CutPrefix(r.URL.Path, c.basePath)
+	if !ok || (urlpath != "" && !strings.HasPrefix(urlpath, "/")) {
+		return nil, nil
+	}
+
+	var (
+		operation *OpenAPIOperation
+		params    map[string]string
+	)
+	for _, op := range c.api.Operations() {
+		if op.Method != r.Method {
+			continue
+		}
+
+		values, ok := MatchPathPattern(op.Path, urlpath)
+		if !ok {
+			continue
+		}
+
+		// prefer the operation with the least named params
+		if operation == nil || len(values) < len(params) {
+			operation, params = op, values
+		}
+	}
+
+	return operation, params
+}
+
+// ValidateRequest returns violations of request with path params, query, headers and JSON body.
+// NOTE: It returns nil for request to host not covered by the contract.
+func (c *Contract) ValidateRequest(r *http.Request, body []byte) []*SchemaViolation {
+	if !c.Covers(r) {
+		return nil
+	}
+
+	op, params := c.Find(r)
+	if op == nil {
+		return []*SchemaViolation{
+			{Pointer: "/", Message: "undocumented operation " + r.Method + " " + r.URL.Path},
+		}
+	}
+
+	var violations []*SchemaViolation
+
+	schema := &Schema{
+		resolve: c.api.resolve,
+	}
+
+	query := r.URL.Query()
+	for _, item := range op.parameters {
+		param, _ := c.api.resolve(item).(map[string]interface{})
+		if param == nil {
+			continue
+		}
+
+		name, _ := param["name"].(string)
+		required, _ := param["required"].(bool)
+
+		var (
+			values  []string
+			pointer string
+		)
+		switch param["in"] {
+		case "path":
+			pointer = "/path/" + escapePointer(name)
+			if value, ok := params[name]; ok {
+				values = []string{value}
+			}
+
+		case "query":
+			pointer = "/query/" + escapePointer(name)
+			values = query[name]
+
+		case "header":
+			pointer = "/header/" + escapePointer(name)
+			values = r.Header.Values(name)
+
+		case "cookie":
+			pointer = "/cookie/" + escapePointer(name)
+			if cookie, err := r.Cookie(name); err == nil {
+				values = []string{cookie.Value}
+			}
+
+		default:
+			continue
+		}
+
+		if len(values) == 0 {
+			if required {
+				violations = append(violations, &SchemaViolation{
+					Pointer: pointer,
+					Message: "required parameter is missing",
+				})
+			}
+
+			continue
+		}
+
+		paramSchema, _ := c.api.resolve(param["schema"]).(map[string]interface{})
+		violations = append(violations, schema.validate(paramSchema, pointer, coerceParameter(paramSchema, values))...)
+	}
+
+	requestBody, _ := c.api.resolve(op.spec["requestBody"]).(map[string]interface{})
+	if requestBody == nil {
+		return violations
+	}
+
+	if len(body) == 0 {
+		if required, _ := requestBody["required"].(bool); required {
+			violations = append(violations, &SchemaViolation{
+				Pointer: "/body",
+				Message: "required request body is missing",
+			})
+		}
+
+		return violations
+	}
+
+	if media := mediaOf(requestBody, r.Header.Get("Content-Type")); media != nil && isJSONMedia(requestBody, r.Header.Get("Content-Type")) {
+		schema.root = media["schema"]
+
+		violations = append(violations, schema.ValidateJSON("/body", body)...)
+	}
+
+	return violations
+}
+
+// ValidateResponse returns violations of response with documented status code and JSON body
+func (c *Contract) ValidateResponse(r *http.Request, resp *http.Response, body []byte) []*SchemaViolation {
+	op, _ := c.Find(r)
+	if op == nil {
+		return nil
+	}
+
+	response, ok := c.responseOf(op, resp.StatusCode)
+	if !ok {
+		return []*SchemaViolation{
+			{Pointer: "/response/status", Message: "undocumented status code " + strconv.Itoa(resp.StatusCode)},
+		}
+	}
+
+	media := mediaOf(response, resp.Header.Get("Content-Type"))
+	if media == nil || len(body) == 0 || !isJSONMedia(response, resp.Header.Get("Content-Type")) {
+		return nil
+	}
+
+	schema := &Schema{
+		root:    media["schema"],
+		resolve: c.api.resolve,
+	}
+
+	return schema.ValidateJSON("/response/body", body)
+}
+
+// responseOf returns documented response of status code, it falls back to range, e.g. 2XX, and default.
+func (c *Contract) responseOf(op *OpenAPIOperation, code int) (map[string]interface{}, bool) {
+	responses, _ := op.spec["responses"].(map[string]interface{})
+
+	status := strconv.Itoa(code)
+
+	node, ok := responses[status]
+	if !ok {
+		node, ok = responses[status[:1]+"XX"]
+	}
+	if !ok {
+		node, ok = responses["default"]
+	}
+	if !ok {
+		return nil, false
+	}
+
+	response, _ := c.api.resolve(node).(map[string]interface{})
+
+	return response, true
+}
+
+// isJSONResponse returns true if body of resp is JSON to validate, stream is never JSON.
+func (c *Contract) isJSONResponse(r *http.Request, resp *http.Response) bool {
+	contentType := resp.Header.Get("Content-Type")
+	if isStreamContent(contentType) {
+		return false
+	}
+	if contentType != "" {
+		return isJSONContent(contentType)
+	}
+
+	op, _ := c.Find(r)
+	if op == nil {
+		return false
+	}
+
+	response, _ := c.responseOf(op, resp.StatusCode)
+
+	return isJSONMedia(response, contentType)
+}
+
+// WithContract validates mocked requests to hosts of contract, and fails the test with pointers to violations.
+// NOTE: The request is answered with *ContractError instead of mocked response if violated.
+func (mitm *MitmTransport) WithContract(contract *Contract) *MitmTransport {
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	mitm.contract = contract
+
+	return mitm
+}
+
+// WithRequestSchema apply JSON Schema of request body for current stub, it can be JSON string, []byte or decoded value.
+func (mitm *MitmTransport) WithRequestSchema(v interface{}) *MitmTransport {
+	schema, err := NewSchema(v)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	mitm.ensureChained()
+
+	mocker := mitm.lastMocker()
+	if mocker == nil {
+		panic(ErrResponse.Error())
+	}
+
+	mocker.SetRequestSchema(schema)
+
+	return mitm
+}
+
+// validateRequest returns *ContractError if request violates contract or JSON Schema of mocker
+func (mitm *MitmTransport) validateRequest(r *http.Request, contract *Contract, mocker *Mocker) error {
+	var schema *Schema
+	if mocker != nil {
+		if target := mocker.resolve(); target != nil {
+			schema = target.RequestSchema()
+		}
+	}
+
+	if contract == nil && schema == nil {
+		return nil
+	}
+
+	body, err := peekRequestBody(r)
+	if err != nil {
+		return err
+	}
+
+	var violations []*SchemaViolation
+	if contract != nil {
+		violations = append(violations, contract.ValidateRequest(r, body)...)
+	}
+	if schema != nil {
+		violations = append(violations, schema.ValidateJSON("/body", body)...)
+	}
+
+	return mitm.reportContract(r, violations)
+}
+
+// validateResponse returns *ContractError if response violates contract
+func (mitm *MitmTransport) validateResponse(r *http.Request, contract *Contract, resp *http.Response) error {
+	if contract == nil || !contract.responses || resp == nil || resp.StatusCode == http.StatusSwitchingProtocols || !contract.Covers(r) {
+		return nil
+	}
+
+	// NOTE: only status code is validated for body not in JSON, e.g. stream of SSE or binary without Content-Type,
+	// which may never be read to end.
+	var body []byte
+	if resp.Body != nil && resp.Body != http.NoBody && contract.isJSONResponse(r, resp) {
+		var err error
+
+		body, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	return mitm.reportContract(r, contract.ValidateResponse(r, resp, body))
+}
+
+func (mitm *MitmTransport) reportContract(r *http.Request, violations []*SchemaViolation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+
+	err := &ContractError{
+		Method:     r.Method,
+		URL:        mitm.originURL(r.URL).String(),
+		Violations: violations,
+	}
+
+	if mitm.testing != nil {
+		mitm.testing.Errorf("%v", err)
+	}
+
+	return err
+}
+
+// peekRequestBody returns data of request body, and restores it for later reading
+func peekRequestBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	return data, nil
+}
+
+// coerceParameter converts values of parameter from string to typed value of schema
+func coerceParameter(schema map[string]interface{}, values []string) interface{} {
+	if schemaType(schema) == "array" {
+		items, _ := schema["items"].(map[string]interface{})
+
+		// comma separated values of form style without explode
+		if len(values) == 1 && strings.Contains(values[0], ",") {
+			values = strings.Split(values[0], ",")
+		}
+
+		list := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			list = append(list, coerceParameter(items, []string{value}))
+		}
+
+		return list
+	}
+
+	value := values[0]
+
+	switch schemaType(schema) {
+	case "integer", "number":
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+
+	return value
+}
+
+// mediaOf returns media type object of content matched with contentType, it falls back to the only one
+func mediaOf(obj map[string]interface{}, contentType string) map[string]interface{} {
+	content, _ := obj["content"].(map[string]interface{})
+
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+
+	if media, ok := content[mediaType].(map[string]interface{}); ok {
+		return media
+	}
+
+	// try wildcard, e.g. application/*
+	if major, _, ok := strings.Cut(mediaType, "/"); ok {
+		if media, ok := content[major+"/*"].(map[string]interface{}); ok {
+			return media
+		}
+	}
+	if media, ok := content["*/*"].(map[string]interface{}); ok {
+		return media
+	}
+
+	if len(content) == 1 {
+		for _, media := range content {
+			obj, _ := media.(map[string]interface{})
+
+			return obj
+		}
+	}
+
+	return nil
+}
+
+func isJSONContent(contentType string) bool {
+	return strings.Contains(strings.ToLower(contentType), "json")
+}
+
+// isJSONMedia returns true for JSON content type, or missing content type if obj declares JSON content only
+func isJSONMedia(obj map[string]interface{}, contentType string) bool {
+	if contentType != "" {
+		return isJSONContent(contentType)
+	}
+
+	content, _ := obj["content"].(map[string]interface{})
+	if len(content) == 0 {
+		return false
+	}
+
+	for mediaType := range content {
+		if !isJSONContent(mediaType) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isStreamContent returns true for content types of streaming, e.g. text/event-stream and application/x-ndjson
+func isStreamContent(contentType string) bool {
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+
+	switch strings.TrimSpace(mediaType) {
+	case "text/event-stream", "application/x-ndjson", "application/stream+json", "application/json-seq":
+		return true
+	}
+
+	return false
+}
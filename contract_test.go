@@ -0,0 +1,214 @@
+package httpmitm
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_ContractValidateRequest(t *testing.T) {
+	it := assert.New(t)
+
+	api, err := LoadOpenAPI("testdata/petstore.yaml")
+	it.Nil(err)
+
+	contract := NewContract(api)
+
+	// valid
+	request, _ := http.NewRequest("GET", "mitm://petstore.example.com/v1/pets/1", nil)
+	request.Header.Set("X-Request-Id", "abc")
+	it.Empty(contract.ValidateRequest(request, nil))
+
+	// path param and header
+	request, _ = http.NewRequest("GET", "mitm://petstore.example.com/v1/pets/kitty", nil)
+	it.Equal([]string{
+		"/path/petId: expected integer, but got string",
+		"/header/X-Request-Id: required parameter is missing",
+	}, violationStrings(contract.ValidateRequest(request, nil)))
+
+	// query
+	request, _ = http.NewRequest("GET", "mitm://petstore.example.com/v1/pets?limit=1000", nil)
+	it.Equal([]string{
+		"/query/limit: expected maximum of 100, but got 1000",
+	}, violationStrings(contract.ValidateRequest(request, nil)))
+
+	// body
+	request, _ = http.NewRequest("POST", "mitm://petstore.example.com/v1/pets", nil)
+	request.Header.Set("Content-Type", "application/json")
+	it.Equal([]string{
+		"/body/name: required property is missing",
+		"/body/tag: expected one of [cat dog], but got bird",
+	}, violationStrings(contract.ValidateRequest(request, []byte(`{"tag":"bird"}`))))
+
+	// undocumented
+	request, _ = http.NewRequest("PUT", "mitm://petstore.example.com/v1/pets", nil)
+	it.Equal(1, len(contract.ValidateRequest(request, nil)))
+
+	// base path is matched by segments
+	request, _ = http.NewRequest("GET", "mitm://petstore.example.com/v10/pets", nil)
+	it.Equal(1, len(contract.ValidateRequest(request, nil)))
+
+	// other hosts are not covered
+	request, _ = http.NewRequest("PUT", "mitm://other.example.com/v1/pets", nil)
+	it.False(contract.Covers(request))
+	it.Empty(contract.ValidateRequest(request, nil))
+}
+
+func Test_MitmTransportWithContract(t *testing.T) {
+	mt := NewMitmTransport()
+
+	it := assert.New(t)
+
+	api, err := mt.MockOpenAPI("testdata/petstore.yaml", "")
+	it.Nil(err)
+
+	mt.WithContract(NewContract(api).WithResponses())
+
+	// overwrite with stale fixture
+	mt.MockRequest("POST", "https://petstore.example.com/v1/pets").WithJsonResponse(201, nil, map[string]interface{}{
+		"id": "10",
+	})
+
+	client := &http.Client{
+		Transport: mt,
+	}
+
+	request, _ := http.NewRequest("GET", "mitm://petstore.example.com/v1/pets/1", nil)
+	request.Header.Set("X-Request-Id", "abc")
+
+	response, err := client.Do(request)
+	it.Nil(err)
+	it.Equal(200, response.StatusCode)
+	response.Body.Close()
+
+	// invalid request
+	_, err = client.Post("mitm://petstore.example.com/v1/pets", "application/json", strings.NewReader(`{}`))
+	it.True(errors.Is(err, ErrContract))
+	it.Contains(err.Error(), "/body/name: required property is missing")
+
+	// invalid response
+	_, err = client.Post("mitm://petstore.example.com/v1/pets", "application/json", strings.NewReader(`{"name":"Kitty"}`))
+	it.True(errors.Is(err, ErrContract))
+	it.Contains(err.Error(), "/response/body/id: expected integer, but got string")
+}
+
+func Test_MitmTransportWithRequestSchema(t *testing.T) {
+	mt := NewMitmTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("POST", mockURL).WithResponse(201, nil, "").AnyTimes().WithRequestSchema(`{
+		"type": "object",
+		"required": ["name"]
+	}`)
+
+	client := &http.Client{
+		Transport: mt,
+	}
+
+	response, err := client.Post(stubURL, "application/json", strings.NewReader(`{"name":"x"}`))
+	it.Nil(err)
+	it.Equal(201, response.StatusCode)
+
+	_, err = client.Post(stubURL, "application/json", strings.NewReader(`{}`))
+	it.True(errors.Is(err, ErrContract))
+	it.Contains(err.Error(), "/body/name: required property is missing")
+}
+
+func Test_MitmTransportWithContractOfStream(t *testing.T) {
+	mt := NewMitmTransport()
+
+	it := assert.New(t)
+
+	api, err := LoadOpenAPI("testdata/petstore.yaml")
+	it.Nil(err)
+
+	mt.WithContract(NewContract(api).WithResponses())
+
+	ch := make(chan []byte)
+	mt.MockRequest("GET", "https://petstore.example.com/v1/pets").WithResponser(NewChannelResponder(200, http.Header{
+		"Content-Type": {"application/x-ndjson"},
+	}, ch))
+
+	client := &http.Client{
+		Transport: mt,
+	}
+
+	// body of stream is not drained for validation
+	response, err := client.Get("mitm://petstore.example.com/v1/pets")
+	it.Nil(err)
+	it.Equal(200, response.StatusCode)
+
+	go func() {
+		ch <- []byte(`{"id":1,"name":"Doggie"}` + "\n")
+		close(ch)
+	}()
+
+	b, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	it.Equal(`{"id":1,"name":"Doggie"}`+"\n", string(b))
+}
+
+func Test_MitmTransportWithContractWithoutContentType(t *testing.T) {
+	mt := NewMitmTransport()
+
+	it := assert.New(t)
+
+	api, err := ParseOpenAPI([]byte(`openapi: 3.0.3
+info:
+  title: Files
+  version: 1.0.0
+servers:
+  - url: https://files.example.com
+paths:
+  /download:
+    get:
+      responses:
+        '200':
+          description: File
+          content:
+            application/octet-stream: {}
+            application/json:
+              schema:
+                type: object
+`))
+	it.Nil(err)
+
+	contract := NewContract(api).WithResponses()
+	mt.WithContract(contract)
+
+	ch := make(chan []byte)
+	mt.MockRequest("GET", "https://files.example.com/download").WithResponser(NewChannelResponder(200, nil, ch))
+
+	// contract can be changed concurrently
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		mt.WithContract(contract)
+	}()
+
+	client := &http.Client{
+		Transport: mt,
+	}
+
+	// body without Content-Type is not drained for validation
+	response, err := client.Get("mitm://files.example.com/download")
+	it.Nil(err)
+	it.Equal(200, response.StatusCode)
+
+	go func() {
+		ch <- []byte("binary")
+		close(ch)
+	}()
+
+	b, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	it.Equal("binary", string(b))
+
+	<-done
+}
@@ -0,0 +1,187 @@
+package httpmitm
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// MatchCookie returns RequestMatcher which matches request with DefaultMatcher and cookie of name.
+// NOTE: any value of the cookie is matched if value is empty.
+func MatchCookie(name, value string) RequestMatcher {
+	return func(r *http.Request, urlobj *url.URL) bool {
+		if !DefaultMatcher(r, urlobj) {
+			return false
+		}
+
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return false
+		}
+
+		return value == "" || cookie.Value == value
+	}
+}
+
+// MatchNoCookie returns RequestMatcher which matches request with DefaultMatcher and without cookie of name.
+func MatchNoCookie(name string) RequestMatcher {
+	return func(r *http.Request, urlobj *url.URL) bool {
+		if !DefaultMatcher(r, urlobj) {
+			return false
+		}
+
+		_, err := r.Cookie(name)
+		return err != nil
+	}
+}
+
+// CookieResponder appends Set-Cookie headers to response of wrapped responder.
+type CookieResponder struct {
+	responder http.RoundTripper
+	cookies   []*http.Cookie
+}
+
+// NewCookieResponder returns CookieResponder which sets cookies with full attributes, e.g. Domain, Path, Expires, SameSite and Secure
+func NewCookieResponder(responder http.RoundTripper, cookies ...*http.Cookie) http.RoundTripper {
+	return &CookieResponder{
+		responder: responder,
+		cookies:   cookies,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (cr *CookieResponder) RoundTrip(req *http.Request) (*http.Response, error) {
+	response, err := cr.responder.RoundTrip(req)
+	if err != nil || response == nil {
+		return response, err
+	}
+
+	header := ownHeader(response)
+	for _, cookie := range cr.cookies {
+		if v := cookie.String(); v != "" {
+			header.Add("Set-Cookie", v)
+		}
+	}
+
+	return response, nil
+}
+
+// WithCookies apply Set-Cookie headers to response of current stub
+func (mitm *MitmTransport) WithCookies(cookies ...*http.Cookie) *MitmTransport {
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	mitm.ensureChained()
+
+	key, _ := mitm.calcRequestKey(mitm.lastMockedMethod, mitm.lastMockedURL)
+
+	responser, ok := mitm.stubs[key]
+	if !ok || !mitm.mocked.Load() {
+		panic(ErrResponse.Error())
+	}
+
+	mocker := responser.FindByRawURL(mitm.lastMockedURL)
+	mocker.SetResponder(NewCookieResponder(mocker.Responder(), cookies...))
+
+	return mitm
+}
+
+// MitmCookieJar wraps http.CookieJar which attributes cookies of mitm scheme to the origin scheme of mocks.
+// NOTE: net/http/cookiejar.Jar ignores urls other than http and https scheme.
+type MitmCookieJar struct {
+	jar  http.CookieJar
+	mitm *MitmTransport
+}
+
+// CookieJar returns MitmCookieJar wrapping jar for http.Client.Jar
+func (mitm *MitmTransport) CookieJar(jar http.CookieJar) *MitmCookieJar {
+	return &MitmCookieJar{
+		jar:  jar,
+		mitm: mitm,
+	}
+}
+
+// SetCookies implements http.CookieJar
+func (j *MitmCookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(j.mitm.originURL(u), cookies)
+}
+
+// Cookies implements http.CookieJar
+func (j *MitmCookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(j.mitm.originURL(u))
+}
+
+// originURL returns copy of urlobj with origin scheme of mocks if it's in mitm scheme.
+// NOTE: it falls back to scheme of any mock of the host if path is not mocked, and defaults to https
+// for mocks registered with mitm scheme.
+func (mitm *MitmTransport) originURL(urlobj *url.URL) *url.URL {
+	if !strings.EqualFold(urlobj.Scheme, MockScheme) {
+		return urlobj
+	}
+
+	origin := *urlobj
+	origin.Scheme = "https"
+
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	fallback := ""
+
+	suffix := " " + strings.TrimRight(strings.ToLower(MockScheme+"://"+urlobj.Host), "/")
+
+	// NOTE: stubs of the host are visited in order of keys, scheme of mocks may differ between methods
+	keys := make([]string, 0, len(mitm.stubs))
+	for key := range mitm.stubs {
+		if strings.HasSuffix(key, suffix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		responser := mitm.stubs[key]
+
+		mocker := responser.Find(urlobj.Path)
+		if mocker == nil {
+			if fallback == "" {
+				fallback = mockedScheme(responser)
+			}
+
+			continue
+		}
+
+		switch scheme := strings.ToLower(mocker.Scheme()); scheme {
+		case "http", "https":
+			origin.Scheme = scheme
+
+			return &origin
+		}
+	}
+
+	if fallback != "" {
+		origin.Scheme = fallback
+	}
+
+	return &origin
+}
+
+// mockedScheme returns origin scheme of the first mock in order of paths, it's empty for mocks registered with mitm scheme.
+func mockedScheme(responser *Responser) string {
+	mocks := responser.Mocks()
+
+	paths := make([]string, 0, len(mocks))
+	for path := range mocks {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		switch scheme := strings.ToLower(mocks[path].Scheme()); scheme {
+		case "http", "https":
+			return scheme
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,131 @@
+package httpmitm
+
+import (
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+)
+
+func Test_MatchCookie(t *testing.T) {
+	it := assert.New(t)
+
+	urlobj, _ := url.Parse(stubURL)
+
+	request, _ := http.NewRequest("GET", stubURL, nil)
+	it.False(MatchCookie("session", "")(request, urlobj))
+	it.True(MatchNoCookie("session")(request, urlobj))
+
+	request.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+	it.True(MatchCookie("session", "")(request, urlobj))
+	it.True(MatchCookie("session", "abc")(request, urlobj))
+	it.False(MatchCookie("session", "xyz")(request, urlobj))
+	it.False(MatchNoCookie("session")(request, urlobj))
+}
+
+func Test_NewCookieResponder(t *testing.T) {
+	it := assert.New(t)
+
+	expires := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	responder := NewCookieResponder(NewResponder(200, nil, "OK"), &http.Cookie{
+		Name:     "session",
+		Value:    "abc",
+		Domain:   "example.com",
+		Path:     "/",
+		Expires:  expires,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	it.Implements((*http.RoundTripper)(nil), responder)
+
+	request, _ := http.NewRequest("GET", mockURL, nil)
+	response, err := responder.RoundTrip(request)
+	it.Nil(err)
+
+	cookies := response.Cookies()
+	it.Equal(1, len(cookies))
+	it.Equal("session", cookies[0].Name)
+	it.Equal("example.com", cookies[0].Domain)
+	it.Equal(expires, cookies[0].Expires)
+	it.True(cookies[0].Secure)
+	it.Equal(http.SameSiteLaxMode, cookies[0].SameSite)
+}
+
+func Test_MitmTransportWithCookieJar(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	// mocks
+	mt.MockRequest("POST", "https://example.com/login").WithResponse(204, nil, "").WithCookies(&http.Cookie{
+		Name:     "session",
+		Value:    "abc",
+		Path:     "/",
+		Secure:   true,
+		HttpOnly: true,
+	})
+	mt.MockRequest("GET", "https://example.com/me").ByMatcher(MatchCookie("session", "abc")).WithResponse(200, nil, "ME")
+
+	jar, _ := cookiejar.New(nil)
+
+	client := &http.Client{
+		Jar: mt.CookieJar(jar),
+	}
+
+	response, err := client.Post("mitm://example.com/login", "text/plain", strings.NewReader(""))
+	it.Nil(err)
+	it.Equal(204, response.StatusCode)
+
+	// cookie is attributed to origin host
+	origin, _ := url.Parse("https://example.com/me")
+	it.Equal(1, len(jar.Cookies(origin)))
+
+	response, err = client.Get("mitm://example.com/me")
+	it.Nil(err)
+	it.Equal(200, response.StatusCode)
+
+	b, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	it.Equal("ME", string(b))
+}
+
+func Test_MitmTransportOriginURLWithSchemes(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	// mocks
+	mt.MockRequest("GET", "http://example.com/profile").WithResponse(200, nil, "")
+	mt.MockRequest("POST", "https://example.com/profile").WithResponse(204, nil, "")
+
+	urlobj, _ := url.Parse("mitm://example.com/profile")
+	for i := 0; i < 10; i++ {
+		it.Equal("http://example.com/profile", mt.originURL(urlobj).String())
+	}
+}
+
+func Test_MitmTransportOriginURLWithFallback(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	// mocks
+	mt.MockRequest("GET", "http://example.com/a").WithResponse(200, nil, "")
+	mt.MockRequest("GET", "https://example.com/b").WithResponse(200, nil, "")
+	mt.MockRequest("GET", "https://example.com/c").WithResponse(200, nil, "")
+
+	urlobj, _ := url.Parse("mitm://example.com/unknown")
+	for i := 0; i < 10; i++ {
+		it.Equal("http://example.com/unknown", mt.originURL(urlobj).String())
+	}
+}
@@ -0,0 +1,631 @@
+package httpmitm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrDefinition = errors.New("invalid mock definition")
+)
+
+// DefinitionError describes an invalid mock definition with its position
+type DefinitionError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (e *DefinitionError) Error() string {
+	return fmt.Sprintf("%s:%d: %s: %s", e.File, e.Line, ErrDefinition.Error(), e.Message)
+}
+
+func (e *DefinitionError) Unwrap() error {
+	return ErrDefinition
+}
+
+// Definitions represents a file of mock definitions in YAML or JSON format, e.g.
+//
+//	mocks:
+//	  - method: GET
+//	    url: https://api.example.com/users/{id}
+//	    match:
+//	      query: {page: "1"}
+//	      headers: {Authorization: Bearer token}
+//	    times: 2 # or any
+//	    response:
+//	      status: 200
+//	      headers: {Content-Type: application/json}
+//	      body: {id: 1, name: mitm} # or text, or bodyFile: fixtures/user.json
+//	      delay: 100ms
+//	  - method: POST
+//	    url: https://api.example.com/users
+//	    sequence:
+//	      - status: 503
+//	      - status: 201
+type Definitions struct {
+	Mocks []*MockDefinition `yaml:"mocks" json:"mocks"`
+}
+
+// MockDefinition defines a mock of request with its response
+type MockDefinition struct {
+	Method   string                `yaml:"method" json:"method"`
+	URL      string                `yaml:"url" json:"url"`
+	Match    *MatchDefinition      `yaml:"match,omitempty" json:"match,omitempty"`
+	Times    string                `yaml:"times,omitempty" json:"times,omitempty"` // non-negative integer or any
+	Response *ResponseDefinition   `yaml:"response,omitempty" json:"response,omitempty"`
+	Sequence []*ResponseDefinition `yaml:"sequence,omitempty" json:"sequence,omitempty"`
+
+	file string
+	line int
+}
+
+// MatchDefinition defines matchers of request in addition to method and url
+type MatchDefinition struct {
+	Query        map[string]string `yaml:"query,omitempty" json:"query,omitempty"`
+	Headers      map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Body         *string           `yaml:"body,omitempty" json:"body,omitempty"`
+	BodyContains string            `yaml:"bodyContains,omitempty" json:"bodyContains,omitempty"`
+	JSON         interface{}       `yaml:"json,omitempty" json:"json,omitempty"` // subset of JSON body
+}
+
+// ResponseDefinition defines a response of mock
+type ResponseDefinition struct {
+	Status   int               `yaml:"status" json:"status"`
+	Headers  map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Body     interface{}       `yaml:"body,omitempty" json:"body,omitempty"` // text, or object and array in JSON
+	BodyFile string            `yaml:"bodyFile,omitempty" json:"bodyFile,omitempty"`
+	Delay    string            `yaml:"delay,omitempty" json:"delay,omitempty"` // duration, e.g. 100ms
+
+	line int
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler with line number and unknown fields check
+func (def *MockDefinition) UnmarshalYAML(node *yaml.Node) error {
+	if err := checkDefinitionFields(node, "method", "url", "match", "times", "response", "sequence"); err != nil {
+		return err
+	}
+
+	type plain MockDefinition
+	if err := node.Decode((*plain)(def)); err != nil {
+		return err
+	}
+
+	def.line = node.Line
+
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler with line number and unknown fields check
+func (def *MatchDefinition) UnmarshalYAML(node *yaml.Node) error {
+	if err := checkDefinitionFields(node, "query", "headers", "body", "bodyContains", "json"); err != nil {
+		return err
+	}
+
+	type plain MatchDefinition
+	if err := node.Decode((*plain)(def)); err != nil {
+		return err
+	}
+
+	def.JSON = normalizeYAML(def.JSON)
+
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler with line number and unknown fields check
+func (def *ResponseDefinition) UnmarshalYAML(node *yaml.Node) error {
+	if err := checkDefinitionFields(node, "status", "headers", "body", "bodyFile", "delay"); err != nil {
+		return err
+	}
+
+	type plain ResponseDefinition
+	if err := node.Decode((*plain)(def)); err != nil {
+		return err
+	}
+
+	def.Body = normalizeYAML(def.Body)
+	def.line = node.Line
+
+	return nil
+}
+
+// ParseDefinitions parses mock definitions in YAML or JSON format, the filename is used for error and relative bodyFile.
+// NOTE: A list of mocks without the top level mocks key is accepted too.
+func ParseDefinitions(filename string, data []byte) (*Definitions, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, definitionError(filename, 0, err)
+	}
+
+	defs := &Definitions{}
+	if len(root.Content) == 0 {
+		return defs, nil
+	}
+
+	doc := root.Content[0]
+
+	var err error
+	switch doc.Kind {
+	case yaml.SequenceNode:
+		err = doc.Decode(&defs.Mocks)
+
+	case yaml.MappingNode:
+		if err = checkDefinitionFields(doc, "mocks"); err == nil {
+			err = doc.Decode(defs)
+		}
+
+	default:
+		err = &DefinitionError{File: filename, Line: doc.Line, Message: "mocks expected"}
+	}
+	if err != nil {
+		return nil, definitionError(filename, doc.Line, err)
+	}
+
+	var errs []error
+	for _, def := range defs.Mocks {
+		def.file = filename
+
+		if err := def.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return defs, nil
+}
+
+// LoadDefinitions loads mock definitions from files or directories, only .yaml, .yml and .json files are loaded within directory.
+func LoadDefinitions(paths ...string) ([]*Definitions, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(name string, entry os.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+
+			switch strings.ToLower(filepath.Ext(name)) {
+			case ".yaml", ".yml", ".json":
+				files = append(files, name)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+
+	var (
+		list []*Definitions
+		errs []error
+	)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		defs, err := ParseDefinitions(file, data)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		list = append(list, defs)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return list, nil
+}
+
+// LoadDefinitions loads mock definitions from files or directories and registers them.
+// NOTE: Nothing is registered if any definition is invalid or duplicated.
+func (mitm *MitmTransport) LoadDefinitions(paths ...string) error {
+	list, err := LoadDefinitions(paths...)
+	if err != nil {
+		return err
+	}
+
+	return mitm.MockDefinitions(list...)
+}
+
+// MockDefinitions registers all mocks of list with MockRequest(method, url) chain.
+// NOTE: Nothing is registered if any definition is invalid, or mocks the same method and url of another one.
+func (mitm *MitmTransport) MockDefinitions(list ...*Definitions) error {
+	var (
+		defs       []*MockDefinition
+		responders []http.RoundTripper
+		errs       []error
+	)
+
+	seen := make(map[string]*MockDefinition)
+	for _, item := range list {
+		for _, def := range item.Mocks {
+			if err := def.Validate(); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			key := def.key()
+			if other, ok := seen[key]; ok {
+				errs = append(errs, &DefinitionError{
+					File:    def.file,
+					Line:    def.line,
+					Message: fmt.Sprintf("duplicated mock of %s %s, which is defined at %s:%d", def.Method, def.URL, other.file, other.line),
+				})
+				continue
+			}
+			seen[key] = def
+
+			responder, err := def.Responder()
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			defs = append(defs, def)
+			responders = append(responders, responder)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	for i, def := range defs {
+		times, _ := def.ExpectedTimes()
+
+		mitm.MockRequest(def.Method, def.URL).ByMatcher(def.Matcher()).WithResponser(responders[i]).Times(times)
+	}
+
+	return nil
+}
+
+// key returns method with host and path of url, which identifies the mock registered
+func (def *MockDefinition) key() string {
+	key := strings.ToUpper(def.Method) + " " + def.URL
+	if urlobj, err := url.Parse(def.URL); err == nil {
+		key = strings.ToUpper(def.Method) + " " + strings.ToLower(urlobj.Host) + urlobj.Path
+	}
+
+	return key
+}
+
+// Validate returns *DefinitionError if the definition is invalid
+func (def *MockDefinition) Validate() error {
+	report := func(line int, format string, args ...interface{}) error {
+		return &DefinitionError{File: def.file, Line: line, Message: fmt.Sprintf(format, args...)}
+	}
+
+	if def.Method == "" {
+		return report(def.line, "method is required")
+	}
+
+	if def.URL == "" {
+		return report(def.line, "url is required")
+	}
+	if urlobj, err := url.Parse(def.URL); err != nil || urlobj.Host == "" {
+		return report(def.line, "absolute url is required, but got %q", def.URL)
+	}
+
+	if _, err := def.ExpectedTimes(); err != nil {
+		return report(def.line, "%v", err)
+	}
+
+	switch {
+	case def.Response == nil && len(def.Sequence) == 0:
+		return report(def.line, "either response or sequence is required")
+
+	case def.Response != nil && len(def.Sequence) > 0:
+		return report(def.line, "response and sequence are exclusive")
+	}
+
+	for _, resp := range append([]*ResponseDefinition{def.Response}, def.Sequence...) {
+		if resp == nil {
+			continue
+		}
+
+		if resp.Status < 100 || resp.Status > 999 {
+			return report(resp.line, "invalid status %d", resp.Status)
+		}
+
+		if resp.Body != nil && resp.BodyFile != "" {
+			return report(resp.line, "body and bodyFile are exclusive")
+		}
+
+		if resp.Delay != "" {
+			if _, err := time.ParseDuration(resp.Delay); err != nil {
+				return report(resp.line, "invalid delay %q", resp.Delay)
+			}
+		}
+
+		if resp.BodyFile != "" {
+			if _, err := os.Stat(def.resolveFile(resp.BodyFile)); err != nil {
+				return report(resp.line, "%v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ExpectedTimes returns expected times of the definition, it defaults to length of sequence or 1.
+func (def *MockDefinition) ExpectedTimes() (int, error) {
+	switch strings.ToLower(def.Times) {
+	case "":
+		if len(def.Sequence) > 0 {
+			return len(def.Sequence), nil
+		}
+
+		return MockDefaultTimes, nil
+
+	case "any":
+		return MockUnlimitedTimes, nil
+	}
+
+	times, err := strconv.Atoi(def.Times)
+	if err != nil || times < 0 {
+		return 0, ErrTimes
+	}
+
+	return times, nil
+}
+
+// Matcher returns RequestMatcher of the definition, which is combined with DefaultMatcher
+func (def *MockDefinition) Matcher() RequestMatcher {
+	match := def.Match
+	if match == nil {
+		return DefaultMatcher
+	}
+
+	return func(r *http.Request, urlobj *url.URL) bool {
+		if !DefaultMatcher(r, urlobj) {
+			return false
+		}
+
+		query := r.URL.Query()
+		for key, value := range match.Query {
+			if query.Get(key) != value {
+				return false
+			}
+		}
+
+		for key, value := range match.Headers {
+			if r.Header.Get(key) != value {
+				return false
+			}
+		}
+
+		if match.Body == nil && match.BodyContains == "" && match.JSON == nil {
+			return true
+		}
+
+		body, err := peekRequestBody(r)
+		if err != nil {
+			return false
+		}
+
+		if match.Body != nil && string(body) != *match.Body {
+			return false
+		}
+
+		if match.BodyContains != "" && !bytes.Contains(body, []byte(match.BodyContains)) {
+			return false
+		}
+
+		if match.JSON != nil {
+			value, err := decodeJSON(body)
+			if err != nil || !jsonContains(value, match.JSON) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// Responder returns http.RoundTripper of the definition
+func (def *MockDefinition) Responder() (http.RoundTripper, error) {
+	if def.Response != nil {
+		return def.newResponder(def.Response)
+	}
+
+	responders := make([]http.RoundTripper, 0, len(def.Sequence))
+	for _, resp := range def.Sequence {
+		responder, err := def.newResponder(resp)
+		if err != nil {
+			return nil, err
+		}
+
+		responders = append(responders, responder)
+	}
+
+	return NewSequenceResponder(responders...), nil
+}
+
+func (def *MockDefinition) newResponder(resp *ResponseDefinition) (http.RoundTripper, error) {
+	header := http.Header{}
+	for key, value := range resp.Headers {
+		header.Set(key, value)
+	}
+
+	var responder http.RoundTripper
+	switch body := resp.Body.(type) {
+	case nil:
+		if resp.BodyFile == "" {
+			responder = NewResponder(resp.Status, header, "")
+			break
+		}
+
+		data, err := os.ReadFile(def.resolveFile(resp.BodyFile))
+		if err != nil {
+			return nil, &DefinitionError{File: def.file, Line: resp.line, Message: err.Error()}
+		}
+
+		responder = NewResponder(resp.Status, header, data)
+
+	case string:
+		responder = NewResponder(resp.Status, header, body)
+
+	default:
+		contentType := header.Get("Content-Type")
+
+		responder = NewJsonResponder(resp.Status, header, body)
+
+		// NOTE: keep defined content type, e.g. application/problem+json
+		if contentType != "" {
+			header.Set("Content-Type", contentType)
+		}
+	}
+
+	if resp.Delay != "" {
+		delay, _ := time.ParseDuration(resp.Delay)
+
+		responder = NewDelayResponder(responder, delay)
+	}
+
+	return responder, nil
+}
+
+// resolveFile returns path of name relative to the definition file
+func (def *MockDefinition) resolveFile(name string) string {
+	if filepath.IsAbs(name) || def.file == "" {
+		return name
+	}
+
+	return filepath.Join(filepath.Dir(def.file), name)
+}
+
+func checkDefinitionFields(node *yaml.Node, fields ...string) error {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+
+		known := false
+		for _, field := range fields {
+			if key.Value == field {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			return &DefinitionError{Line: key.Line, Message: "unknown field " + strconv.Quote(key.Value)}
+		}
+	}
+
+	return nil
+}
+
+// definitionError returns *DefinitionError with file and line of err
+func definitionError(filename string, line int, err error) error {
+	var defErr *DefinitionError
+	if errors.As(err, &defErr) {
+		defErr.File = filename
+
+		return defErr
+	}
+
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) && len(typeErr.Errors) > 0 {
+		// yaml reports with "line N: message"
+		msg := typeErr.Errors[0]
+		if _, rest, ok := strings.Cut(msg, "line "); ok {
+			if n, tail, ok := strings.Cut(rest, ": "); ok {
+				if v, err := strconv.Atoi(n); err == nil {
+					return &DefinitionError{File: filename, Line: v, Message: tail}
+				}
+			}
+		}
+
+		return &DefinitionError{File: filename, Line: line, Message: msg}
+	}
+
+	msg := err.Error()
+	if rest, ok := strings.CutPrefix(msg, "yaml: line "); ok {
+		if n, tail, ok := strings.Cut(rest, ": "); ok {
+			if v, err := strconv.Atoi(n); err == nil {
+				return &DefinitionError{File: filename, Line: v, Message: tail}
+			}
+		}
+	}
+
+	return &DefinitionError{File: filename, Line: line, Message: msg}
+}
+
+// jsonContains returns true if value contains all fields and items of subset
+func jsonContains(value, subset interface{}) bool {
+	switch s := subset.(type) {
+	case map[string]interface{}:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+
+		for key, item := range s {
+			if !jsonContains(obj[key], item) {
+				return false
+			}
+		}
+
+		return true
+
+	case []interface{}:
+		list, ok := value.([]interface{})
+		if !ok || len(list) != len(s) {
+			return false
+		}
+
+		for i, item := range s {
+			if !jsonContains(list[i], item) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return jsonEqual(value, subset)
+}
+
+// WriteDefinitions encodes defs in YAML format
+func WriteDefinitions(w io.Writer, defs *Definitions) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+
+	if err := encoder.Encode(defs); err != nil {
+		return err
+	}
+
+	return encoder.Close()
+}
@@ -0,0 +1,215 @@
+package httpmitm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_ParseDefinitions(t *testing.T) {
+	it := assert.New(t)
+
+	defs, err := ParseDefinitions("mocks.yaml", []byte(`
+- method: GET
+  url: https://api.example.com/users
+  times: any
+  response:
+    status: 200
+    body: [1, 2]
+`))
+	it.Nil(err)
+	it.Equal(1, len(defs.Mocks))
+
+	def := defs.Mocks[0]
+	it.Equal("GET", def.Method)
+	it.Equal(2, def.line)
+
+	times, err := def.ExpectedTimes()
+	it.Nil(err)
+	it.Equal(MockUnlimitedTimes, times)
+	it.Equal([]interface{}{1, 2}, def.Response.Body)
+}
+
+func Test_ParseDefinitionsWithError(t *testing.T) {
+	it := assert.New(t)
+
+	testCases := []struct {
+		data    string
+		line    int
+		message string
+	}{
+		{"mocks:\n  - method: GET\n    url: https://api.example.com\n    response:\n      status: 200\n      unknown: true\n", 6, `unknown field "unknown"`},
+		{"mocks:\n  - method: GET\n    url: /relative\n    response:\n      status: 200\n", 2, `absolute url is required, but got "/relative"`},
+		{"mocks:\n  - method: GET\n    url: https://api.example.com\n    times: twice\n    response:\n      status: 200\n", 2, ErrTimes.Error()},
+		{"mocks:\n  - method: GET\n    url: https://api.example.com\n", 2, "either response or sequence is required"},
+		{"mocks:\n  - method: GET\n    url: https://api.example.com\n    sequence:\n      - status: 200\n      - status: 200\n        delay: soon\n", 6, `invalid delay "soon"`},
+		{"mocks:\n  - method: GET\n    url: https://api.example.com\n    response:\n      status: ok\n", 5, "cannot unmarshal !!str `ok` into int"},
+		{"mocks: [\n", 1, "did not find expected node content"},
+	}
+
+	for _, testCase := range testCases {
+		_, err := ParseDefinitions("mocks.yaml", []byte(testCase.data))
+		it.True(errors.Is(err, ErrDefinition), testCase.data)
+
+		var defErr *DefinitionError
+		if it.True(errors.As(err, &defErr), testCase.data) {
+			it.Equal("mocks.yaml", defErr.File)
+			it.Equal(testCase.line, defErr.Line, testCase.data)
+			it.Contains(defErr.Message, testCase.message)
+		}
+	}
+
+	// all invalid mocks are reported
+	_, err := ParseDefinitions("mocks.yaml", []byte(`
+- method: GET
+  url: https://api.example.com
+- url: https://api.example.com
+  response:
+    status: 200
+`))
+	it.Contains(err.Error(), "mocks.yaml:2: ")
+	it.Contains(err.Error(), "mocks.yaml:4: ")
+}
+
+func Test_LoadDefinitions(t *testing.T) {
+	it := assert.New(t)
+
+	list, err := LoadDefinitions("testdata/mocks")
+	it.Nil(err)
+
+	if it.Equal(2, len(list)) {
+		it.Equal("https://api.example.com/health", list[0].Mocks[0].URL)
+		it.Equal("https://api.example.com/users/{id}", list[1].Mocks[0].URL)
+	}
+
+	_, err = LoadDefinitions("testdata/invalid_definitions.yaml")
+	it.Contains(err.Error(), "testdata/invalid_definitions.yaml:6: ")
+
+	_, err = LoadDefinitions("testdata/missing")
+	it.NotNil(err)
+}
+
+func Test_WriteDefinitions(t *testing.T) {
+	it := assert.New(t)
+
+	defs := &Definitions{
+		Mocks: []*MockDefinition{
+			{
+				Method:   "GET",
+				URL:      "https://api.example.com/users",
+				Response: &ResponseDefinition{Status: 200, Body: "OK"},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	it.Nil(WriteDefinitions(&buf, defs))
+
+	parsed, err := ParseDefinitions("mocks.yaml", buf.Bytes())
+	it.Nil(err)
+	it.Equal("OK", parsed.Mocks[0].Response.Body)
+}
+
+func Test_MitmTransportLoadDefinitions(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	err := mt.LoadDefinitions("testdata/mocks")
+	it.Nil(err)
+
+	// query and header matchers
+	_, err = http.Get("mitm://api.example.com/users/1")
+	it.NotNil(err)
+
+	request, _ := http.NewRequest("GET", "mitm://api.example.com/users/1?verbose=true", nil)
+	request.Header.Set("Authorization", "Bearer token")
+
+	for i := 0; i < 3; i++ {
+		response, err := http.DefaultClient.Do(request)
+		it.Nil(err)
+		it.Equal(http.StatusOK, response.StatusCode)
+
+		b, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		it.Equal(`{"id":1,"name":"mitm"}`, string(b))
+	}
+
+	// json matcher with sequence
+	response, err := http.Post("mitm://api.example.com/users", "application/json", strings.NewReader(`{"name":"mitm","age":1}`))
+	it.Nil(err)
+	it.Equal(http.StatusServiceUnavailable, response.StatusCode)
+
+	b, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	it.Equal("unavailable", string(b))
+
+	response, err = http.Post("mitm://api.example.com/users", "application/json", strings.NewReader(`{"name":"mitm"}`))
+	it.Nil(err)
+	it.Equal(http.StatusCreated, response.StatusCode)
+	it.Equal("application/json", response.Header.Get("Content-Type"))
+
+	b, _ = io.ReadAll(response.Body)
+	response.Body.Close()
+	it.Equal(`{"id":2,"name":"mitm"}`, strings.TrimSpace(string(b)))
+
+	for i := 0; i < 2; i++ {
+		response, err = http.Get("mitm://api.example.com/health")
+		it.Nil(err)
+		it.Equal(http.StatusNoContent, response.StatusCode)
+	}
+}
+
+func Test_MitmTransportLoadDefinitionsWithError(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	err := mt.LoadDefinitions("testdata/mocks", "testdata/invalid_definitions.yaml")
+	it.True(errors.Is(err, ErrDefinition))
+	it.False(mt.isHostMocked("api.example.com"))
+}
+
+func Test_MitmTransportMockDefinitionsWithDuplicate(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	users, err := ParseDefinitions("users.yaml", []byte(`mocks:
+  - method: GET
+    url: https://dup.example.com/users
+    match:
+      query: {page: "1"}
+    response:
+      status: 200
+`))
+	it.Nil(err)
+
+	admins, err := ParseDefinitions("admins.yaml", []byte(`mocks:
+  - method: GET
+    url: https://dup.example.com/admins
+    response:
+      status: 200
+  - method: get
+    url: https://DUP.example.com/users
+    match:
+      query: {page: "2"}
+    response:
+      status: 200
+`))
+	it.Nil(err)
+
+	err = mt.MockDefinitions(users, admins)
+	it.True(errors.Is(err, ErrDefinition))
+	it.Contains(err.Error(), "admins.yaml:6: ")
+	it.Contains(err.Error(), "defined at users.yaml:2")
+	it.False(mt.isHostMocked("dup.example.com"))
+}
@@ -0,0 +1,303 @@
+package httpmitm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentEncoder creates a writer which compresses data written into w with named Content-Encoding
+type ContentEncoder func(w io.Writer) (io.WriteCloser, error)
+
+var (
+	contentEncodersMux sync.RWMutex
+	contentEncoders    = map[string]ContentEncoder{
+		"gzip": func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+		"deflate": func(w io.Writer) (io.WriteCloser, error) {
+			return zlib.NewWriter(w), nil
+		},
+	}
+)
+
+// RegisterContentEncoder registers encoder for Content-Encoding name, e.g. br or zstd.
+// NOTE: it overwrites existed encoder with the same name.
+func RegisterContentEncoder(name string, encoder ContentEncoder) {
+	contentEncodersMux.Lock()
+	defer contentEncodersMux.Unlock()
+
+	contentEncoders[strings.ToLower(name)] = encoder
+}
+
+// LookupContentEncoder returns registered encoder of Content-Encoding name
+func LookupContentEncoder(name string) (ContentEncoder, bool) {
+	contentEncodersMux.RLock()
+	defer contentEncodersMux.RUnlock()
+
+	encoder, ok := contentEncoders[strings.ToLower(name)]
+	return encoder, ok
+}
+
+// EncodingResponder compresses response body of wrapped responder according to Accept-Encoding of request.
+type EncodingResponder struct {
+	responder   http.RoundTripper
+	encodings   []string
+	transparent bool
+}
+
+// NewEncodingResponder returns EncodingResponder which compresses with encodings allowed, all registered encodings are allowed if none given.
+func NewEncodingResponder(responder http.RoundTripper, encodings ...string) http.RoundTripper {
+	return &EncodingResponder{
+		responder: responder,
+		encodings: encodings,
+	}
+}
+
+// NewTransparentEncodingResponder returns EncodingResponder which mimics transparent gzip of net/http.
+// NOTE: For request without Accept-Encoding, it responds with Uncompressed=true and Content-Length header stripped if gzip is allowed.
+func NewTransparentEncodingResponder(responder http.RoundTripper, encodings ...string) http.RoundTripper {
+	return &EncodingResponder{
+		responder:   responder,
+		encodings:   encodings,
+		transparent: true,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (er *EncodingResponder) RoundTrip(req *http.Request) (*http.Response, error) {
+	transparent := er.transparent && req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == ""
+
+	response, err := er.responder.RoundTrip(req)
+	if err != nil || response == nil || response.Body == nil {
+		return response, err
+	}
+
+	// response is encoded already or has no body
+	if response.Header.Get("Content-Encoding") != "" || req.Method == http.MethodHead ||
+		response.StatusCode == http.StatusNoContent || response.StatusCode == http.StatusNotModified || response.ContentLength == 0 {
+		return response, nil
+	}
+
+	// NOTE: body decompressed by transport is the same as the origin, thus it's never compressed actually
+	if transparent {
+		if !er.isAllowed("gzip") {
+			return response, nil
+		}
+
+		header := ownHeader(response)
+		header.Add("Vary", "Accept-Encoding")
+		header.Del("Content-Length")
+
+		response.ContentLength = -1
+		response.Uncompressed = true
+
+		return response, nil
+	}
+
+	name, encoder, identityOK := er.negotiate(req.Header.Get("Accept-Encoding"))
+	if encoder == nil {
+		if identityOK {
+			return response, nil
+		}
+
+		// neither encodings nor identity is acceptable, e.g. identity;q=0
+		if response.Body != nil {
+			response.Body.Close()
+		}
+
+		return NewResponder(http.StatusNotAcceptable, http.Header{"Vary": {"Accept-Encoding"}}, http.StatusText(http.StatusNotAcceptable)).RoundTrip(req)
+	}
+
+	ownHeader(response).Add("Vary", "Accept-Encoding")
+
+	response.Header.Set("Content-Encoding", name)
+
+	// compress in memory for sized body, otherwise compress on the fly
+	if response.ContentLength > 0 {
+		body, err := encodeBody(response.Body, encoder)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		response.Body = io.NopCloser(bytes.NewReader(data))
+		response.Header.Set("Content-Length", strconv.Itoa(len(data)))
+		response.ContentLength = int64(len(data))
+	} else {
+		body, err := encodeBody(response.Body, encoder)
+		if err != nil {
+			return nil, err
+		}
+
+		response.Body = body
+		response.Header.Del("Content-Length")
+		response.ContentLength = -1
+	}
+
+	return response, nil
+}
+
+// negotiate returns the most preferred encoding accepted by client as RFC 9110 section 12.5.3, * matches any
+// encoding not listed. It returns nil encoder for identity, and false if identity is not acceptable either.
+func (er *EncodingResponder) negotiate(accept string) (string, ContentEncoder, bool) {
+	type candidate struct {
+		name    string
+		quality float64
+	}
+
+	qualities := make(map[string]float64)
+
+	var names []string
+	for _, item := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = v
+			}
+		}
+
+		if _, ok := qualities[name]; !ok {
+			names = append(names, name)
+		}
+		qualities[name] = quality
+	}
+
+	wildcard, hasWildcard := qualities["*"]
+
+	// NOTE: identity is acceptable by default, and only preferred to encodings when listed or matched by *
+	identity, listed := qualities["identity"]
+	if !listed && hasWildcard {
+		identity, listed = wildcard, true
+	}
+
+	var candidates []candidate
+	for _, name := range names {
+		if name == "*" || name == "identity" {
+			continue
+		}
+
+		candidates = append(candidates, candidate{
+			name:    name,
+			quality: qualities[name],
+		})
+	}
+
+	if hasWildcard {
+		for _, name := range er.availableEncodings() {
+			if _, ok := qualities[name]; ok {
+				continue
+			}
+
+			candidates = append(candidates, candidate{
+				name:    name,
+				quality: wildcard,
+			})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].quality > candidates[j].quality
+	})
+
+	for _, c := range candidates {
+		if c.quality <= 0 || (listed && c.quality < identity) || !er.isAllowed(c.name) {
+			continue
+		}
+
+		if encoder, ok := LookupContentEncoder(c.name); ok {
+			return c.name, encoder, true
+		}
+	}
+
+	return "", nil, !listed || identity > 0
+}
+
+// availableEncodings returns names of encodings matched by *, the allowed order or gzip and deflate first.
+func (er *EncodingResponder) availableEncodings() []string {
+	if len(er.encodings) > 0 {
+		names := make([]string, 0, len(er.encodings))
+		for _, name := range er.encodings {
+			names = append(names, strings.ToLower(name))
+		}
+
+		return names
+	}
+
+	contentEncodersMux.RLock()
+	defer contentEncodersMux.RUnlock()
+
+	preferred := map[string]int{"gzip": 0, "deflate": 1}
+
+	names := make([]string, 0, len(contentEncoders))
+	for name := range contentEncoders {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		pi, iok := preferred[names[i]]
+		pj, jok := preferred[names[j]]
+		if iok || jok {
+			return iok && (!jok || pi < pj)
+		}
+
+		return names[i] < names[j]
+	})
+
+	return names
+}
+
+func (er *EncodingResponder) isAllowed(name string) bool {
+	if len(er.encodings) == 0 {
+		return true
+	}
+
+	for _, encoding := range er.encodings {
+		if strings.EqualFold(encoding, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// encodeBody returns reader of body compressed by encoder within a goroutine
+func encodeBody(body io.ReadCloser, encoder ContentEncoder) (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+
+	writer, err := encoder(pw)
+	if err != nil {
+		body.Close()
+
+		return nil, err
+	}
+
+	go func() {
+		_, err := io.Copy(writer, body)
+		if cerr := writer.Close(); err == nil {
+			err = cerr
+		}
+		body.Close()
+
+		pw.CloseWithError(err)
+	}()
+
+	return pr, nil
+}
@@ -0,0 +1,194 @@
+package httpmitm
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_NewEncodingResponder(t *testing.T) {
+	it := assert.New(t)
+
+	body := strings.Repeat("Hello, world!", 100)
+
+	responder := NewEncodingResponder(NewResponder(200, nil, body))
+	it.Implements((*http.RoundTripper)(nil), responder)
+
+	// gzip
+	request, _ := http.NewRequest("GET", mockURL, nil)
+	request.Header.Set("Accept-Encoding", "deflate;q=0.5, gzip")
+
+	response, err := responder.RoundTrip(request)
+	it.Nil(err)
+	it.Equal("gzip", response.Header.Get("Content-Encoding"))
+	it.False(response.Uncompressed)
+	it.True(response.ContentLength > 0)
+	it.True(response.ContentLength < int64(len(body)))
+
+	gzipReader, err := gzip.NewReader(response.Body)
+	it.Nil(err)
+
+	b, err := io.ReadAll(gzipReader)
+	response.Body.Close()
+	it.Nil(err)
+	it.Equal(body, string(b))
+
+	// deflate
+	request.Header.Set("Accept-Encoding", "deflate")
+
+	response, err = responder.RoundTrip(request)
+	it.Nil(err)
+	it.Equal("deflate", response.Header.Get("Content-Encoding"))
+
+	zlibReader, err := zlib.NewReader(response.Body)
+	it.Nil(err)
+
+	b, err = io.ReadAll(zlibReader)
+	response.Body.Close()
+	it.Nil(err)
+	it.Equal(body, string(b))
+
+	// identity
+	request.Header.Set("Accept-Encoding", "identity")
+
+	response, err = responder.RoundTrip(request)
+	it.Nil(err)
+	it.Empty(response.Header.Get("Content-Encoding"))
+
+	b, _ = io.ReadAll(response.Body)
+	response.Body.Close()
+	it.Equal(body, string(b))
+}
+
+func Test_NewEncodingResponderWithCustomEncoder(t *testing.T) {
+	it := assert.New(t)
+
+	RegisterContentEncoder("upper", func(w io.Writer) (io.WriteCloser, error) {
+		return &upperWriter{w: w}, nil
+	})
+
+	responder := NewEncodingResponder(NewChunkedResponder(200, nil, 0, []byte("hello, "), []byte("world!")), "upper")
+
+	request, _ := http.NewRequest("GET", mockURL, nil)
+	request.Header.Set("Accept-Encoding", "gzip, upper")
+
+	response, err := responder.RoundTrip(request)
+	it.Nil(err)
+	it.Equal("upper", response.Header.Get("Content-Encoding"))
+	it.Equal(int64(-1), response.ContentLength)
+
+	b, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	it.Equal("HELLO, WORLD!", string(b))
+}
+
+func Test_NewTransparentEncodingResponder(t *testing.T) {
+	it := assert.New(t)
+
+	body := "Hello, world!"
+
+	responder := NewTransparentEncodingResponder(NewResponder(200, nil, body))
+
+	// without Accept-Encoding
+	request, _ := http.NewRequest("GET", mockURL, nil)
+
+	response, err := responder.RoundTrip(request)
+	it.Nil(err)
+	it.True(response.Uncompressed)
+	it.Empty(response.Header.Get("Content-Encoding"))
+	it.Empty(response.Header.Get("Content-Length"))
+	it.Equal(int64(-1), response.ContentLength)
+
+	b, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	it.Equal(body, string(b))
+
+	// with explicit Accept-Encoding
+	request.Header.Set("Accept-Encoding", "gzip")
+
+	response, err = responder.RoundTrip(request)
+	it.Nil(err)
+	it.False(response.Uncompressed)
+	it.Equal("gzip", response.Header.Get("Content-Encoding"))
+	response.Body.Close()
+
+	// gzip is not allowed
+	responder = NewTransparentEncodingResponder(NewResponder(200, nil, body), "deflate")
+
+	request.Header.Del("Accept-Encoding")
+
+	response, err = responder.RoundTrip(request)
+	it.Nil(err)
+	it.False(response.Uncompressed)
+	it.Equal(int64(len(body)), response.ContentLength)
+	response.Body.Close()
+}
+
+type upperWriter struct {
+	w io.Writer
+}
+
+func (uw *upperWriter) Write(p []byte) (int, error) {
+	return uw.w.Write([]byte(strings.ToUpper(string(p))))
+}
+
+func (uw *upperWriter) Close() error {
+	return nil
+}
+
+func Test_NewEncodingResponderWithWildcardAndIdentity(t *testing.T) {
+	it := assert.New(t)
+
+	body := strings.Repeat("Hello, world!", 100)
+
+	responder := NewEncodingResponder(NewResponder(200, nil, body))
+
+	cases := []struct {
+		accept   string
+		code     int
+		encoding string
+	}{
+		{"*", 200, "gzip"},
+		{"*;q=0.5, deflate", 200, "deflate"},
+		{"gzip;q=0, *", 200, "deflate"},
+		{"identity;q=0.5, gzip;q=0.1", 200, ""},
+		{"identity, gzip", 200, "gzip"},
+		{"identity;q=0, gzip", 200, "gzip"},
+		{"identity;q=0, br", 406, ""},
+		{"*;q=0", 406, ""},
+		{"*;q=0, identity", 200, ""},
+		{"", 200, ""},
+	}
+
+	for _, c := range cases {
+		request, _ := http.NewRequest("GET", mockURL, nil)
+		request.Header.Set("Accept-Encoding", c.accept)
+
+		response, err := responder.RoundTrip(request)
+		if !it.Nil(err, c.accept) {
+			continue
+		}
+		response.Body.Close()
+
+		it.Equal(c.code, response.StatusCode, c.accept)
+		it.Equal(c.encoding, response.Header.Get("Content-Encoding"), c.accept)
+	}
+
+	// * matches allowed encodings only
+	responder = NewEncodingResponder(NewResponder(200, nil, body), "deflate")
+
+	request, _ := http.NewRequest("GET", mockURL, nil)
+	request.Header.Set("Accept-Encoding", "*")
+
+	response, err := responder.RoundTrip(request)
+	if it.Nil(err) {
+		response.Body.Close()
+
+		it.Equal("deflate", response.Header.Get("Content-Encoding"))
+	}
+}
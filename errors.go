@@ -12,4 +12,9 @@ var (
 	ErrTimes       = errors.New("invalid value of times. It must be non-negative integer value")
 	ErrInvocation  = errors.New("not an chained invocation. Please invoking MockRequest(method, url) first")
 	ErrResponse    = errors.New("not an chained response. Please invoking WithResponser(code, header, body) first")
+	ErrScenario    = errors.New("not an chained scenario. Please invoking WhenState(state) before WithResponser(responder)")
+	ErrRedirects   = errors.New("invalid redirect chain. It must have one more url than codes")
+	ErrCertificate = errors.New("invalid certificate authority. It must be a CA certificate with PKCS #8 private key in PEM format")
+	ErrRequestBody = errors.New("invalid request body. Please making sure the body is not reused without GetBody")
+	ErrExpectation = errors.New("unexpected invocation of mock. Please making sure the request is issued with expected times")
 )
@@ -2,7 +2,10 @@ module github.com/dolab/httpmitm
 
 go 1.24.1
 
-require github.com/golib/assert v1.8.0
+require (
+	github.com/golib/assert v1.8.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/buger/jsonparser v1.1.1 // indirect
@@ -0,0 +1,68 @@
+package httpmitm
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	// MaxRequestHistory is the max number of requests kept in history, the oldest ones are dropped.
+	MaxRequestHistory = 1000
+)
+
+// RequestRecord describes a request issued with mitm scheme
+type RequestRecord struct {
+	Time       time.Time     `json:"time"`
+	Method     string        `json:"method"`
+	URL        string        `json:"url"` // origin url of the request
+	Body       string        `json:"body,omitempty"`
+	StatusCode int           `json:"status,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// History returns copy of requests issued with mitm scheme in order, the latest last.
+func (mitm *MitmTransport) History() []*RequestRecord {
+	mitm.historyMux.Lock()
+	defer mitm.historyMux.Unlock()
+
+	history := make([]*RequestRecord, len(mitm.history))
+	copy(history, mitm.history)
+
+	return history
+}
+
+// ResetHistory removes all requests of history
+func (mitm *MitmTransport) ResetHistory() {
+	mitm.historyMux.Lock()
+	defer mitm.historyMux.Unlock()
+
+	mitm.history = nil
+}
+
+func (mitm *MitmTransport) newRequestRecord(r *http.Request) *RequestRecord {
+	return &RequestRecord{
+		Time:   mitm.Clock().Now(),
+		Method: r.Method,
+		URL:    mitm.originURL(r.URL).String(),
+	}
+}
+
+func (mitm *MitmTransport) addRequestRecord(record *RequestRecord, resp *http.Response, err error) {
+	record.Duration = mitm.Clock().Now().Sub(record.Time)
+
+	if resp != nil {
+		record.StatusCode = resp.StatusCode
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	mitm.historyMux.Lock()
+	defer mitm.historyMux.Unlock()
+
+	mitm.history = append(mitm.history, record)
+	if len(mitm.history) > MaxRequestHistory {
+		mitm.history = mitm.history[len(mitm.history)-MaxRequestHistory:]
+	}
+}
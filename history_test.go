@@ -0,0 +1,39 @@
+package httpmitm
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_MitmTransportHistory(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "http://example.com/users").WithResponse(200, nil, "")
+
+	response, err := http.Get("mitm://example.com/users?page=1")
+	it.Nil(err)
+	response.Body.Close()
+
+	_, err = http.Get("mitm://unknown.example.com")
+	it.NotNil(err)
+
+	history := mt.History()
+	if it.Equal(2, len(history)) {
+		it.Equal("GET", history[0].Method)
+		it.Equal("http://example.com/users?page=1", history[0].URL)
+		it.Equal(200, history[0].StatusCode)
+		it.Empty(history[0].Error)
+
+		it.Equal("https://unknown.example.com", history[1].URL)
+		it.Equal(0, history[1].StatusCode)
+		it.Equal(ErrRefused.Error(), history[1].Error)
+	}
+
+	mt.ResetHistory()
+	it.Empty(mt.History())
+}
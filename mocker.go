@@ -1,8 +1,11 @@
 package httpmitm
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"math"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"strings"
 	"sync"
@@ -18,7 +21,8 @@ const (
 var (
 	// DefaultMatcher is the default implementation of RequestMatcher and is used by all mocks without matcher supplied.
 	// 	First, it compares request by fully quoted url string;
-	// 	Second, it only compares uri by trim string after separator ? in fallback case.
+	// 	Second, it only compares uri by trim string after separator ? in fallback case;
+	// 	Third, it compares path with named params pattern, e.g. /user/{id}.
 	DefaultMatcher RequestMatcher = func(r *http.Request, urlobj *url.URL) bool {
 		// case-insensitive
 
@@ -32,6 +36,13 @@ var (
 			return true
 		}
 
+		// third, try path pattern
+		if strings.EqualFold(r.URL.Host, urlobj.Host) && IsPathPattern(urlobj.Path) {
+			_, ok := MatchPathPattern(urlobj.Path, r.URL.Path)
+
+			return ok
+		}
+
 		return false
 	}
 )
@@ -49,6 +60,21 @@ type Mocker struct {
 	originScheme  string // origin url scheme
 	expectedTimes int    // expect mocked times
 	invokedTimes  int    // really mocked times
+
+	scenario  *Scenario // scenario of the mocker, nil for stateless
+	whenState string    // required state of scenario, empty for any state
+	thenState string    // state transited to after mocked, empty for none
+
+	requestSchema *Schema // JSON Schema of request body, nil for none
+
+	traceTimings TraceTimings // simulated timings of httptrace.ClientTrace events
+	proto        string       // protocol version of responses, empty for HTTP/1.1
+
+	certificates      []*x509.Certificate // peer certificates of https mock, nil for minted by CA
+	certificateErr    error               // error of failed TLS handshake
+	certificateFailed bool                // indicate whether TLS handshake fails?
+
+	next *Mocker // alternative mocker of the same request path
 }
 
 func NewMocker(responder http.RoundTripper, rawurl string, times int) *Mocker {
@@ -79,6 +105,16 @@ func (m *Mocker) IsRequestMatched(req *http.Request) bool {
 	return m.matcher(req, urlobj)
 }
 
+// originURL returns url of req with origin scheme of the mocker
+func (m *Mocker) originURL(req *http.Request) string {
+	urlobj := *req.URL
+	if m.originScheme != "" {
+		urlobj.Scheme = m.originScheme
+	}
+
+	return urlobj.String()
+}
+
 func (m *Mocker) IsTimesUnlimited() bool {
 	return m.expectedTimes == MockUnlimitedTimes
 }
@@ -99,9 +135,31 @@ func (m *Mocker) Scheme() string {
 }
 
 func (m *Mocker) Times() (expected, invoked int) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
 	return m.expectedTimes, m.invokedTimes
 }
 
+// RawURL returns mocked url of the mocker
+func (m *Mocker) RawURL() string {
+	return m.rawurl
+}
+
+func (m *Mocker) Responder() http.RoundTripper {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	return m.responder
+}
+
+func (m *Mocker) SetResponder(responder http.RoundTripper) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.responder = responder
+}
+
 func (m *Mocker) SetMatcher(matcher RequestMatcher) {
 	m.mux.Lock()
 	defer m.mux.Unlock()
@@ -116,32 +174,245 @@ func (m *Mocker) SetExpectedTimes(expected int) {
 	m.expectedTimes = expected
 }
 
+// SetRequestSchema applies JSON Schema validating request body of the mocker
+func (m *Mocker) SetRequestSchema(schema *Schema) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.requestSchema = schema
+}
+
+// RequestSchema returns JSON Schema of request body, nil for none
+func (m *Mocker) RequestSchema() *Schema {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	return m.requestSchema
+}
+
+// SetTraceTimings applies simulated timings of httptrace.ClientTrace events of the mocker
+func (m *Mocker) SetTraceTimings(timings TraceTimings) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.traceTimings = timings
+}
+
+// TraceTimings returns simulated timings of httptrace.ClientTrace events
+func (m *Mocker) TraceTimings() TraceTimings {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	return m.traceTimings
+}
+
+// SetProto applies protocol version of responses, e.g. HTTP/1.1 or HTTP/2.0
+func (m *Mocker) SetProto(proto string) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.proto = proto
+}
+
+// SetCertificates applies peer certificate chain of https mocker, the leaf first
+func (m *Mocker) SetCertificates(chain ...*x509.Certificate) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.certificates = chain
+}
+
+// SetCertificateError makes TLS handshake of https mocker fail with err, see MitmTransport.WithCertificateError for details.
+func (m *Mocker) SetCertificateError(err error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.certificateErr = err
+	m.certificateFailed = true
+}
+
+// SetScenario makes the mocker only matches when scenario is in whenState, and transits scenario to thenState after mocked.
+// NOTE: empty whenState matches any state, and empty thenState keeps state untouched.
+func (m *Mocker) SetScenario(scenario *Scenario, whenState, thenState string) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.scenario = scenario
+	m.whenState = whenState
+	m.thenState = thenState
+}
+
+// Scenario returns scenario with required and transited states of the mocker
+func (m *Mocker) Scenario() (scenario *Scenario, whenState, thenState string) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	return m.scenario, m.whenState, m.thenState
+}
+
+// IsStateful returns true if the mocker requires a state of scenario
+func (m *Mocker) IsStateful() bool {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	return m.scenario != nil && m.whenState != ""
+}
+
+// Alternatives returns all mockers of the same request path, including itself.
+func (m *Mocker) Alternatives() (mocks []*Mocker) {
+	for mocker := m; mocker != nil; mocker = mocker.next {
+		mocks = append(mocks, mocker)
+	}
+
+	return
+}
+
+// isSameState returns true if both mockers match the same state of scenario
+func (m *Mocker) isSameState(other *Mocker) bool {
+	if !m.IsStateful() || !other.IsStateful() {
+		return m.IsStateful() == other.IsStateful()
+	}
+
+	scenario, whenState, _ := m.Scenario()
+	otherScenario, otherState, _ := other.Scenario()
+
+	return scenario == otherScenario && whenState == otherState
+}
+
+// resolve returns mocker of alternatives which matches state of scenario,
+// it prefers stateful mocker and falls back to the latest stateless one.
+func (m *Mocker) resolve() *Mocker {
+	var fallback *Mocker
+
+	for mocker := m; mocker != nil; mocker = mocker.next {
+		if !mocker.IsStateful() {
+			if fallback == nil {
+				fallback = mocker
+			}
+
+			continue
+		}
+
+		scenario, whenState, _ := mocker.Scenario()
+		if scenario.State() == whenState {
+			return mocker
+		}
+	}
+
+	return fallback
+}
+
 func (m *Mocker) RoundTrip(req *http.Request) (*http.Response, error) {
+	mocker := m.resolve()
+	if mocker == nil {
+		return NotFoundResponser.RoundTrip(req)
+	}
+
+	_, resp, err := mocker.roundTrip(req, nil, nil, nil)
+
+	return resp, err
+}
+
+// mockOutcome describes how a request is handled by the mocker
+type mockOutcome int
+
+const (
+	mockMatched   mockOutcome = iota // responded by responder
+	mockUnmatched                    // rejected by matcher
+	mockExceeded                     // passed through to origin for expected times exceeded
+)
+
+func (m *Mocker) roundTrip(req *http.Request, ca *CertificateAuthority, chaos *ChaosPolicy, notify func(*ChaosInjection)) (mockOutcome, *http.Response, error) {
 	// is mocked?
 	m.mux.RLock()
 	if !m.IsRequestMatched(req) {
 		m.mux.RUnlock()
 
-		return httpDefaultResponder.RoundTrip(req)
+		resp, err := httpDefaultResponder.RoundTrip(req)
+
+		return mockUnmatched, resp, err
 	}
 	m.mux.RUnlock()
 
+	// rewind body consumed by matcher
+	if req.GetBody != nil && req.Body != nil && req.Body != http.NoBody {
+		if body, err := req.GetBody(); err == nil {
+			req.Body = body
+		}
+	}
+
+	// NOTE: only counters and state of scenario are updated with lock, responder and trace may sleep with clock,
+	// which must not block concurrent requests of the mock.
 	m.mux.Lock()
-	defer m.mux.Unlock()
 
 	m.invokedTimes++
 
-	switch {
-	case m.IsTimesUnlimited(): // is an unlimited mocker?
-		return m.responder.RoundTrip(req)
+	if !m.IsTimesUnlimited() && m.invokedTimes > m.expectedTimes { // is expected times exceed?
+		m.mux.Unlock()
 
-	case m.invokedTimes > m.expectedTimes: // is expected times exceed?
 		if m.originScheme != "" {
 			req.URL.Scheme = m.originScheme
 		}
 
-		return httpDefaultResponder.RoundTrip(req)
+		resp, err := chaos.roundTrip(req, req.URL.String(), true, httpDefaultResponder.RoundTrip, notify)
+
+		return mockExceeded, resp, err
+	}
+
+	// transit state of scenario
+	if m.scenario != nil && m.thenState != "" {
+		m.scenario.SetState(m.thenState)
+	}
+
+	// simulate TLS of https origin
+	var (
+		state  *tls.ConnectionState
+		tlsErr error
+	)
+	if m.originScheme == "https" {
+		state, tlsErr = m.connectionState(ca)
+	}
+
+	responder, proto, timings := m.responder, m.proto, m.traceTimings
+
+	m.mux.Unlock()
+
+	// resolve named params of path pattern
+	if urlobj, err := url.Parse(m.rawurl); err == nil && IsPathPattern(urlobj.Path) {
+		if params, ok := MatchPathPattern(urlobj.Path, req.URL.Path); ok {
+			req = withPathParams(req, params)
+		}
+	}
+
+	// simulate connection of a real round trip
+	trace := httptrace.ContextClientTrace(req.Context())
+	if trace != nil {
+		if err := traceConnect(req, trace, m.rawurl, m.originScheme, state, tlsErr, timings); err != nil {
+			return mockMatched, nil, err
+		}
+	}
+
+	if tlsErr != nil {
+		return mockMatched, nil, tlsErr
+	}
+
+	resp, err := chaos.roundTrip(req, m.originURL(req), false, responder.RoundTrip, notify)
+	if err != nil {
+		return mockMatched, resp, err
+	}
+
+	if resp != nil {
+		normalizeResponse(req, resp, proto)
+
+		if resp.TLS == nil && state != nil {
+			tlsState := *state
+			resp.TLS = &tlsState
+		}
+	}
+
+	if trace != nil && trace.GotFirstResponseByte != nil {
+		trace.GotFirstResponseByte()
 	}
 
-	return m.responder.RoundTrip(req)
+	return mockMatched, resp, err
 }
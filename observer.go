@@ -0,0 +1,270 @@
+package httpmitm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Reasons of requests passed through to the origin
+const (
+	PassthroughPaused   = "paused"   // all mocks are paused
+	PassthroughExceeded = "exceeded" // expected times of the mock exceeded
+	PassthroughUnmocked = "unmocked" // no mock of the request, e.g. forwarded by MitmHandler
+)
+
+// Observer receives events of requests issued with mitm scheme, e.g. for tracing which mock answered which request.
+// Embed NopObserver for implementing a subset of events.
+// NOTE: Events are emitted synchronously, observers must not register or remove mocks of the same transport.
+type Observer interface {
+	// OnRequest is invoked when a request is received
+	OnRequest(r *http.Request)
+
+	// OnMatched is invoked when a mock answered the request
+	OnMatched(r *http.Request, stub *StubSnapshot)
+
+	// OnUnmatched is invoked when no mock answered the request, err is ErrRefused for unmocked host and ErrNotFound otherwise
+	OnUnmatched(r *http.Request, err error)
+
+	// OnPassthrough is invoked when the request is sent to the origin with reason, e.g. PassthroughPaused
+	OnPassthrough(r *http.Request, reason string)
+
+	// OnResponse is invoked when a response is returned
+	OnResponse(r *http.Request, resp *http.Response, duration time.Duration)
+
+	// OnErrorInjected is invoked when the mock answered the request with an error, e.g. ErrTimeout, or a fault
+	// injected by ChaosPolicy as *ChaosError.
+	OnErrorInjected(r *http.Request, stub *StubSnapshot, err error)
+
+	// OnExpectationFailure is invoked when the mock is invoked with unexpected times or the request violates contract,
+	// r is nil for failures reported by UnstubDefaultTransport.
+	OnExpectationFailure(r *http.Request, stub *StubSnapshot, err error)
+}
+
+// NopObserver implements Observer which ignores all events
+type NopObserver struct{}
+
+func (NopObserver) OnRequest(r *http.Request)                                               {}
+func (NopObserver) OnMatched(r *http.Request, stub *StubSnapshot)                           {}
+func (NopObserver) OnUnmatched(r *http.Request, err error)                                  {}
+func (NopObserver) OnPassthrough(r *http.Request, reason string)                            {}
+func (NopObserver) OnResponse(r *http.Request, resp *http.Response, duration time.Duration) {}
+func (NopObserver) OnErrorInjected(r *http.Request, stub *StubSnapshot, err error)          {}
+func (NopObserver) OnExpectationFailure(r *http.Request, stub *StubSnapshot, err error)     {}
+
+// ExpectationError represents a mock invoked with unexpected times
+type ExpectationError struct {
+	Method   string
+	URL      string
+	Expected int
+	Invoked  int
+}
+
+func (e *ExpectationError) Error() string {
+	return fmt.Sprintf("Expected %s %s with %d times, but got %d times", e.Method, e.URL, e.Expected, e.Invoked)
+}
+
+func (e *ExpectationError) Unwrap() error {
+	return ErrExpectation
+}
+
+// Observe registers observers of requests, see Observer for events.
+func (mitm *MitmTransport) Observe(observers ...Observer) *MitmTransport {
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	for _, observer := range observers {
+		if observer != nil {
+			mitm.observers = append(mitm.observers, observer)
+		}
+	}
+
+	return mitm
+}
+
+// observer returns observers registered
+func (mitm *MitmTransport) observer() observers {
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	return mitm.observers
+}
+
+// observers dispatches events to all observers, stubs are described only if there is any observer.
+type observers []Observer
+
+func (obs observers) request(r *http.Request) {
+	for _, observer := range obs {
+		observer.OnRequest(r)
+	}
+}
+
+func (obs observers) matched(r *http.Request, mocker *Mocker) {
+	if len(obs) == 0 {
+		return
+	}
+
+	stub := newStubSnapshot(strings.ToUpper(r.Method), mocker)
+	for _, observer := range obs {
+		observer.OnMatched(r, stub)
+	}
+}
+
+func (obs observers) unmatched(r *http.Request, err error) {
+	for _, observer := range obs {
+		observer.OnUnmatched(r, err)
+	}
+}
+
+func (obs observers) passthrough(r *http.Request, reason string) {
+	for _, observer := range obs {
+		observer.OnPassthrough(r, reason)
+	}
+}
+
+func (obs observers) response(r *http.Request, resp *http.Response, duration time.Duration) {
+	for _, observer := range obs {
+		observer.OnResponse(r, resp, duration)
+	}
+}
+
+func (obs observers) errorInjected(r *http.Request, mocker *Mocker, err error) {
+	if len(obs) == 0 {
+		return
+	}
+
+	stub := newStubSnapshot(strings.ToUpper(r.Method), mocker)
+	for _, observer := range obs {
+		observer.OnErrorInjected(r, stub, err)
+	}
+}
+
+// failedExpectation describes a failure collected for notifying observers later
+type failedExpectation struct {
+	method string
+	mocker *Mocker
+	err    error
+}
+
+func (obs observers) expectationFailure(r *http.Request, method string, mocker *Mocker, err error) {
+	if len(obs) == 0 {
+		return
+	}
+
+	var stub *StubSnapshot
+	if mocker != nil {
+		stub = newStubSnapshot(method, mocker)
+	}
+
+	for _, observer := range obs {
+		observer.OnExpectationFailure(r, stub, err)
+	}
+}
+
+// SlogObserver implements Observer which logs events with *slog.Logger.
+// Requests and responses are logged at debug level, unmatched requests at warn level and expectation failures at error level.
+type SlogObserver struct {
+	logger *slog.Logger
+}
+
+// NewSlogObserver returns *SlogObserver of logger, it defaults to slog.Default() if nil.
+func NewSlogObserver(logger *slog.Logger) *SlogObserver {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &SlogObserver{
+		logger: logger,
+	}
+}
+
+func (o *SlogObserver) OnRequest(r *http.Request) {
+	o.log(r, slog.LevelDebug, "httpmitm: request received",
+		slog.String("method", r.Method),
+		slog.String("url", r.URL.String()),
+	)
+}
+
+func (o *SlogObserver) OnMatched(r *http.Request, stub *StubSnapshot) {
+	o.log(r, slog.LevelInfo, "httpmitm: mock matched",
+		slog.String("method", r.Method),
+		slog.String("url", r.URL.String()),
+		slogStub(stub),
+	)
+}
+
+func (o *SlogObserver) OnUnmatched(r *http.Request, err error) {
+	o.log(r, slog.LevelWarn, "httpmitm: mock unmatched",
+		slog.String("method", r.Method),
+		slog.String("url", r.URL.String()),
+		slog.Any("error", err),
+	)
+}
+
+func (o *SlogObserver) OnPassthrough(r *http.Request, reason string) {
+	o.log(r, slog.LevelInfo, "httpmitm: passthrough",
+		slog.String("method", r.Method),
+		slog.String("url", r.URL.String()),
+		slog.String("reason", reason),
+	)
+}
+
+func (o *SlogObserver) OnResponse(r *http.Request, resp *http.Response, duration time.Duration) {
+	o.log(r, slog.LevelDebug, "httpmitm: response returned",
+		slog.String("method", r.Method),
+		slog.String("url", r.URL.String()),
+		slog.Int("status", resp.StatusCode),
+		slog.Duration("duration", duration),
+	)
+}
+
+func (o *SlogObserver) OnErrorInjected(r *http.Request, stub *StubSnapshot, err error) {
+	o.log(r, slog.LevelInfo, "httpmitm: error injected",
+		slog.String("method", r.Method),
+		slog.String("url", r.URL.String()),
+		slogStub(stub),
+		slog.Any("error", err),
+	)
+}
+
+func (o *SlogObserver) OnExpectationFailure(r *http.Request, stub *StubSnapshot, err error) {
+	attrs := []any{
+		slogStub(stub),
+		slog.Any("error", err),
+	}
+	if r != nil {
+		attrs = append([]any{
+			slog.String("method", r.Method),
+			slog.String("url", r.URL.String()),
+		}, attrs...)
+	}
+
+	o.log(r, slog.LevelError, "httpmitm: expectation failure", attrs...)
+}
+
+func (o *SlogObserver) log(r *http.Request, level slog.Level, msg string, args ...any) {
+	ctx := context.Background()
+	if r != nil {
+		ctx = r.Context()
+	}
+
+	o.logger.Log(ctx, level, msg, args...)
+}
+
+func slogStub(stub *StubSnapshot) slog.Attr {
+	if stub == nil {
+		return slog.Group("mock")
+	}
+
+	return slog.Group("mock",
+		slog.String("method", stub.Method),
+		slog.String("url", stub.URL),
+		slog.String("matcher", stub.Matcher),
+		slog.String("responder", stub.Responder),
+		slog.Int("expected", stub.Expected),
+		slog.Int("invoked", stub.Invoked),
+	)
+}
@@ -0,0 +1,253 @@
+package httpmitm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+)
+
+type recordingObserver struct {
+	mux    sync.Mutex
+	events []string
+}
+
+func (o *recordingObserver) add(event string) {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	o.events = append(o.events, event)
+}
+
+func (o *recordingObserver) Events() []string {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	events := o.events
+	o.events = nil
+
+	return events
+}
+
+func (o *recordingObserver) OnRequest(r *http.Request) {
+	o.add("request " + r.Method + " " + r.URL.String())
+}
+
+func (o *recordingObserver) OnMatched(r *http.Request, stub *StubSnapshot) {
+	o.add("matched " + stub.Method + " " + stub.URL)
+}
+
+func (o *recordingObserver) OnUnmatched(r *http.Request, err error) {
+	o.add("unmatched " + err.Error())
+}
+
+func (o *recordingObserver) OnPassthrough(r *http.Request, reason string) {
+	o.add("passthrough " + reason)
+}
+
+func (o *recordingObserver) OnResponse(r *http.Request, resp *http.Response, duration time.Duration) {
+	o.add("response " + resp.Status)
+}
+
+func (o *recordingObserver) OnErrorInjected(r *http.Request, stub *StubSnapshot, err error) {
+	o.add("error " + stub.URL + " " + err.Error())
+}
+
+func (o *recordingObserver) OnExpectationFailure(r *http.Request, stub *StubSnapshot, err error) {
+	o.add("expectation " + err.Error())
+}
+
+func Test_MitmTransportObserve(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer origin.Close()
+
+	host := strings.TrimPrefix(origin.URL, "http://")
+
+	observer := &recordingObserver{}
+
+	mt := NewMitmTransport().Observe(observer, nil)
+
+	it := assert.New(t)
+
+	client := &http.Client{Transport: mt}
+
+	mt.MockRequest("GET", origin.URL+"/users").WithResponse(200, nil, "")
+	mt.MockRequest("GET", origin.URL+"/timeout").WithResponser(NewTimeoutResponder())
+	mt.MockRequest("POST", origin.URL+"/users").ByMatcher(MatchCookie("session", "xxx")).WithResponse(201, nil, "")
+
+	response, err := client.Get("mitm://" + host + "/users")
+	if it.Nil(err) {
+		response.Body.Close()
+	}
+	it.Equal([]string{
+		"request GET mitm://" + host + "/users",
+		"matched GET " + origin.URL + "/users",
+		"response 200 OK",
+	}, observer.Events())
+
+	// times exceeded
+	response, err = client.Get("mitm://" + host + "/users")
+	if it.Nil(err) {
+		it.Equal(http.StatusAccepted, response.StatusCode)
+		response.Body.Close()
+	}
+	it.Equal([]string{
+		"request GET mitm://" + host + "/users",
+		"expectation Expected GET " + origin.URL + "/users with 1 times, but got 2 times",
+		"passthrough exceeded",
+		"response 202 Accepted",
+	}, observer.Events())
+
+	_, err = client.Get("mitm://" + host + "/timeout")
+	it.True(errors.Is(err, ErrTimeout))
+	it.Equal([]string{
+		"request GET mitm://" + host + "/timeout",
+		"matched GET " + origin.URL + "/timeout",
+		"error " + origin.URL + "/timeout " + ErrTimeout.Error(),
+	}, observer.Events())
+
+	_, err = client.Post("mitm://"+host+"/users", "", nil)
+	it.NotNil(err)
+	it.Equal([]string{
+		"request POST mitm://" + host + "/users",
+		"unmatched " + ErrNotFound.Error(),
+	}, observer.Events())
+
+	_, err = client.Get("mitm://api.example.com/users")
+	it.True(errors.Is(err, ErrRefused))
+	it.Equal([]string{
+		"request GET mitm://api.example.com/users",
+		"unmatched " + ErrRefused.Error(),
+	}, observer.Events())
+
+	mt.SetPaused(true)
+
+	response, err = client.Get("mitm://" + host + "/users")
+	if it.Nil(err) {
+		response.Body.Close()
+	}
+	it.Equal([]string{
+		"request GET mitm://" + host + "/users",
+		"passthrough paused",
+		"response 202 Accepted",
+	}, observer.Events())
+}
+
+func Test_MitmHandlerObservePassthrough(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "origin")
+	}))
+	defer origin.Close()
+
+	observer := &recordingObserver{}
+
+	mt := NewMitmTransport().Observe(observer)
+	mt.MockRequest("GET", origin.URL+"/mocked").WithResponse(200, nil, "")
+
+	it := assert.New(t)
+
+	srv := httptest.NewServer(mt.Handler().WithDefaultHost(strings.TrimPrefix(origin.URL, "http://")).WithPassthrough(http.DefaultTransport))
+	defer srv.Close()
+
+	response, err := http.Get(srv.URL + "/users")
+	if it.Nil(err) {
+		data, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+
+		it.Equal("origin", string(data))
+	}
+	it.Equal([]string{"passthrough unmocked"}, observer.Events())
+}
+
+func Test_SlogObserver(t *testing.T) {
+	var buf bytes.Buffer
+
+	mt := NewMitmTransport().Observe(NewSlogObserver(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, nil, "")
+
+	client := &http.Client{Transport: mt}
+
+	response, err := client.Get("mitm://api.example.com/users")
+	if it.Nil(err) {
+		response.Body.Close()
+	}
+
+	_, err = client.Get("mitm://api.example.com/unknown")
+	it.NotNil(err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if it.Equal(5, len(lines)) {
+		it.Contains(lines[0], `level=DEBUG msg="httpmitm: request received" method=GET url=mitm://api.example.com/users`)
+		it.Contains(lines[1], `level=INFO msg="httpmitm: mock matched" method=GET url=mitm://api.example.com/users mock.method=GET mock.url=https://api.example.com/users mock.matcher=default mock.responder=Responder mock.expected=1 mock.invoked=1`)
+		it.Contains(lines[2], `level=DEBUG msg="httpmitm: response returned" method=GET url=mitm://api.example.com/users status=200`)
+		it.Contains(lines[3], `level=DEBUG msg="httpmitm: request received" method=GET url=mitm://api.example.com/unknown`)
+		it.Contains(lines[4], `level=WARN msg="httpmitm: mock unmatched"`)
+	}
+}
+
+type snapshotObserver struct {
+	NopObserver
+
+	mt        *MitmTransport
+	snapshots []*Snapshot
+}
+
+func (o *snapshotObserver) OnExpectationFailure(r *http.Request, stub *StubSnapshot, err error) {
+	o.snapshots = append(o.snapshots, o.mt.Snapshot())
+}
+
+func Test_MitmTransportObserveUnstub(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer origin.Close()
+
+	mt := NewMitmTransport()
+
+	observer := &snapshotObserver{mt: mt}
+	mt.Observe(observer)
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", origin.URL+"/users").WithResponse(200, nil, "")
+
+	client := &http.Client{Transport: mt}
+
+	// times exceeded
+	for i := 0; i < 2; i++ {
+		response, err := client.Get(strings.Replace(origin.URL, "http", MockScheme, 1) + "/users")
+		if it.Nil(err) {
+			response.Body.Close()
+		}
+	}
+	it.Equal(1, len(observer.snapshots))
+
+	// NOTE: transport is not stubbed, thus there is no t to fail
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		mt.UnstubDefaultTransport()
+	}()
+
+	select {
+	case <-done:
+		it.Equal(2, len(observer.snapshots))
+
+	case <-time.After(time.Second):
+		t.Fatal("UnstubDefaultTransport deadlocks with observer calling back into transport")
+	}
+}
@@ -0,0 +1,499 @@
+package httpmitm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrOpenAPI = errors.New("invalid OpenAPI document")
+
+	openapiMethods = []string{
+		http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete,
+		http.MethodOptions, http.MethodHead, http.MethodPatch, http.MethodTrace,
+	}
+)
+
+// OpenAPI represents a loaded OpenAPI 3 document in either JSON or YAML format.
+type OpenAPI struct {
+	doc        map[string]interface{}
+	operations []*OpenAPIOperation
+}
+
+// OpenAPIOperation represents an operation of OpenAPI document
+type OpenAPIOperation struct {
+	Method      string
+	Path        string // path template, e.g. /pets/{petId}
+	OperationID string
+
+	spec       map[string]interface{}
+	parameters []interface{} // merged parameters of path item and operation
+}
+
+// LoadOpenAPI loads OpenAPI 3 document from local file in JSON or YAML format
+func LoadOpenAPI(filename string) (*OpenAPI, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseOpenAPI(data)
+}
+
+// ParseOpenAPI parses OpenAPI 3 document in JSON or YAML format
+func ParseOpenAPI(data []byte) (*OpenAPI, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOpenAPI, err)
+	}
+
+	doc, ok := normalizeYAML(raw).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: object expected", ErrOpenAPI)
+	}
+
+	version, _ := doc["openapi"].(string)
+	if !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("%w: unsupported version %q", ErrOpenAPI, version)
+	}
+
+	api := &OpenAPI{
+		doc: doc,
+	}
+
+	paths, _ := doc["paths"].(map[string]interface{})
+
+	templates := make([]string, 0, len(paths))
+	for template := range paths {
+		templates = append(templates, template)
+	}
+	sort.Strings(templates)
+
+	for _, template := range templates {
+		item, _ := api.resolve(paths[template]).(map[string]interface{})
+		if item == nil {
+			continue
+		}
+
+		common, _ := item["parameters"].([]interface{})
+
+		for _, method := range openapiMethods {
+			spec, ok := item[strings.ToLower(method)].(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			operationID, _ := spec["operationId"].(string)
+
+			op := &OpenAPIOperation{
+				Method:      method,
+				Path:        template,
+				OperationID: operationID,
+				spec:        spec,
+			}
+
+			// operation parameters overwrite path item parameters with the same name and location
+			own, _ := spec["parameters"].([]interface{})
+			for _, param := range common {
+				if !api.hasParameter(own, param) {
+					op.parameters = append(op.parameters, param)
+				}
+			}
+			op.parameters = append(op.parameters, own...)
+
+			api.operations = append(api.operations, op)
+		}
+	}
+
+	return api, nil
+}
+
+// Operations returns all operations of the document sorted by path
+func (api *OpenAPI) Operations() []*OpenAPIOperation {
+	return api.operations
+}
+
+// Operation returns operation of operationId
+func (api *OpenAPI) Operation(operationID string) *OpenAPIOperation {
+	for _, op := range api.operations {
+		if op.OperationID == operationID {
+			return op
+		}
+	}
+
+	return nil
+}
+
+// ServerURL returns the first url of servers, it's empty if none defined
+func (api *OpenAPI) ServerURL() string {
+	urls := api.ServerURLs()
+	if len(urls) == 0 {
+		return ""
+	}
+
+	return urls[0]
+}
+
+// ServerURLs returns urls of all servers in order, server variables are substituted with defaults.
+func (api *OpenAPI) ServerURLs() []string {
+	servers, _ := api.doc["servers"].([]interface{})
+
+	urls := make([]string, 0, len(servers))
+	for _, item := range servers {
+		server, _ := item.(map[string]interface{})
+		rawurl, _ := server["url"].(string)
+
+		variables, _ := server["variables"].(map[string]interface{})
+		for name, variable := range variables {
+			if v, ok := variable.(map[string]interface{}); ok {
+				rawurl = strings.ReplaceAll(rawurl, "{"+name+"}", fmt.Sprint(v["default"]))
+			}
+		}
+
+		urls = append(urls, strings.TrimRight(rawurl, "/"))
+	}
+
+	return urls
+}
+
+// Example returns status code, content type and body of the documented response for mocking.
+// It prefers the lowest 2xx response, and uses documented example or generates one from schema.
+func (api *OpenAPI) Example(op *OpenAPIOperation) (code int, contentType string, body interface{}) {
+	responses, _ := op.spec["responses"].(map[string]interface{})
+
+	var status string
+	for key := range responses {
+		if strings.HasPrefix(key, "2") && (status == "" || key < status) {
+			status = key
+		}
+	}
+	if status == "" {
+		if _, ok := responses["default"]; ok {
+			status = "default"
+		}
+	}
+
+	code, _ = strconv.Atoi(strings.ReplaceAll(strings.ToUpper(status), "X", "0"))
+	if code == 0 {
+		code = http.StatusOK
+	}
+
+	response, _ := api.resolve(responses[status]).(map[string]interface{})
+
+	content, _ := response["content"].(map[string]interface{})
+	if len(content) == 0 {
+		return
+	}
+
+	// prefer json content
+	types := make([]string, 0, len(content))
+	for key := range content {
+		types = append(types, key)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		ji, jj := strings.Contains(types[i], "json"), strings.Contains(types[j], "json")
+		if ji != jj {
+			return ji
+		}
+
+		return types[i] < types[j]
+	})
+	contentType = types[0]
+
+	media, _ := content[contentType].(map[string]interface{})
+	if example, ok := media["example"]; ok {
+		return code, contentType, example
+	}
+
+	if examples, ok := media["examples"].(map[string]interface{}); ok && len(examples) > 0 {
+		names := make([]string, 0, len(examples))
+		for name := range examples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		if example, ok := api.resolve(examples[names[0]]).(map[string]interface{}); ok {
+			return code, contentType, example["value"]
+		}
+	}
+
+	return code, contentType, api.Generate(media["schema"])
+}
+
+// Generate returns a value conforms to the schema
+func (api *OpenAPI) Generate(schema interface{}) interface{} {
+	return api.generate(schema, 0)
+}
+
+func (api *OpenAPI) generate(node interface{}, depth int) interface{} {
+	schema, _ := api.resolve(node).(map[string]interface{})
+	if schema == nil || depth > 8 {
+		return nil
+	}
+
+	if example, ok := schema["example"]; ok {
+		return example
+	}
+	if value, ok := schema["default"]; ok {
+		return value
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		merged := map[string]interface{}{}
+		for _, sub := range allOf {
+			if v, ok := api.generate(sub, depth+1).(map[string]interface{}); ok {
+				for key, value := range v {
+					merged[key] = value
+				}
+			}
+		}
+
+		return merged
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if subs, ok := schema[key].([]interface{}); ok && len(subs) > 0 {
+			return api.generate(subs[0], depth+1)
+		}
+	}
+
+	switch schemaType(schema) {
+	case "object":
+		value := map[string]interface{}{}
+
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, property := range properties {
+			value[name] = api.generate(property, depth+1)
+		}
+
+		return value
+
+	case "array":
+		return []interface{}{api.generate(schema["items"], depth+1)}
+
+	case "integer":
+		if minimum, ok := toFloat(schema["minimum"]); ok {
+			return int64(minimum)
+		}
+
+		return 0
+
+	case "number":
+		if minimum, ok := toFloat(schema["minimum"]); ok {
+			return minimum
+		}
+
+		return 0.0
+
+	case "boolean":
+		return true
+
+	case "string":
+		switch schema["format"] {
+		case "date-time":
+			return "2006-01-02T15:04:05Z"
+		case "date":
+			return "2006-01-02"
+		case "email":
+			return "user@example.com"
+		case "uuid":
+			return "00000000-0000-0000-0000-000000000000"
+		case "uri", "url":
+			return "https://example.com"
+		}
+
+		if minLength, ok := toFloat(schema["minLength"]); ok && minLength > 6 {
+			return strings.Repeat("x", int(minLength))
+		}
+
+		return "string"
+	}
+
+	return nil
+}
+
+// resolve returns node referenced by local $ref, e.g. #/components/schemas/Pet
+func (api *OpenAPI) resolve(node interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		obj, ok := node.(map[string]interface{})
+		if !ok {
+			return node
+		}
+
+		ref, ok := obj["$ref"].(string)
+		if !ok {
+			return node
+		}
+
+		node = api.lookup(ref)
+	}
+
+	return nil
+}
+
+func (api *OpenAPI) lookup(ref string) interface{} {
+	pointer, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil
+	}
+
+	var node interface{} = api.doc
+	for _, token := range strings.Split(pointer, "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+
+		obj, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		node = obj[token]
+	}
+
+	return node
+}
+
+func (api *OpenAPI) hasParameter(params []interface{}, param interface{}) bool {
+	target, _ := api.resolve(param).(map[string]interface{})
+
+	for _, item := range params {
+		p, _ := api.resolve(item).(map[string]interface{})
+		if p != nil && target != nil && p["name"] == target["name"] && p["in"] == target["in"] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MockOpenAPI stubs all operations of OpenAPI document from local file with documented examples for any times.
+// NOTE: The baseurl defaults to the first url of servers if empty, and each operation can be overwritten with MockRequest(method, url).
+func (mitm *MitmTransport) MockOpenAPI(filename, baseurl string) (*OpenAPI, error) {
+	api, err := LoadOpenAPI(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if baseurl == "" {
+		baseurl = api.ServerURL()
+	}
+	if !strings.Contains(baseurl, "://") {
+		return nil, fmt.Errorf("%w: absolute base url is required, but got %q", ErrOpenAPI, baseurl)
+	}
+	baseurl = strings.TrimRight(baseurl, "/")
+
+	for _, op := range api.Operations() {
+		code, contentType, body := api.Example(op)
+
+		header := http.Header{}
+		if contentType != "" {
+			header.Set("Content-Type", contentType)
+		}
+
+		// NOTE: string example of json media type is a json string, e.g. "ok" for application/json
+		if text, ok := body.(string); ok && strings.Contains(strings.ToLower(contentType), "json") {
+			data, _ := json.Marshal(text)
+
+			body = string(data)
+		}
+
+		var responder http.RoundTripper
+		switch v := body.(type) {
+		case nil:
+			responder = NewResponder(code, header, "")
+
+		case string:
+			responder = NewResponder(code, header, v)
+
+		default:
+			responder = NewJsonResponder(code, header, v)
+
+			// NOTE: keep documented content type, e.g. application/problem+json
+			if contentType != "" {
+				header.Set("Content-Type", contentType)
+			}
+		}
+
+		mitm.MockRequest(op.Method, baseurl+op.Path).WithResponser(responder).AnyTimes()
+	}
+
+	return api, nil
+}
+
+func schemaType(schema map[string]interface{}) string {
+	switch v := schema["type"].(type) {
+	case string:
+		return v
+
+	case []interface{}:
+		// OpenAPI 3.1 allows type list, e.g. [string, "null"]
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "null" {
+				return s
+			}
+		}
+
+	case nil:
+		if _, ok := schema["properties"]; ok {
+			return "object"
+		}
+		if _, ok := schema["items"]; ok {
+			return "array"
+		}
+	}
+
+	return ""
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+
+	return 0, false
+}
+
+// normalizeYAML converts mappings with non-string keys decoded by yaml, e.g. status codes, to map[string]interface{}
+func normalizeYAML(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for key, value := range t {
+			t[key] = normalizeYAML(value)
+		}
+
+		return t
+
+	case map[interface{}]interface{}:
+		obj := make(map[string]interface{}, len(t))
+		for key, value := range t {
+			obj[fmt.Sprint(key)] = normalizeYAML(value)
+		}
+
+		return obj
+
+	case []interface{}:
+		for i, value := range t {
+			t[i] = normalizeYAML(value)
+		}
+
+		return t
+	}
+
+	return v
+}
@@ -0,0 +1,155 @@
+package httpmitm
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_LoadOpenAPI(t *testing.T) {
+	it := assert.New(t)
+
+	api, err := LoadOpenAPI("testdata/petstore.yaml")
+	it.Nil(err)
+	it.Equal("https://petstore.example.com/v1", api.ServerURL())
+	it.Equal(4, len(api.Operations()))
+
+	op := api.Operation("showPetById")
+	it.NotNil(op)
+	it.Equal("GET", op.Method)
+	it.Equal("/pets/{petId}", op.Path)
+
+	code, contentType, body := api.Example(op)
+	it.Equal(200, code)
+	it.Equal("application/json", contentType)
+	it.Equal(map[string]interface{}{"id": 1, "name": "Doggie", "tag": "dog"}, body)
+
+	// generated from schema
+	code, _, body = api.Example(api.Operation("listPets"))
+	it.Equal(200, code)
+	it.Equal([]interface{}{map[string]interface{}{"id": 0, "name": "string", "tag": "cat"}}, body)
+
+	// without content
+	code, contentType, body = api.Example(api.Operation("deletePet"))
+	it.Equal(204, code)
+	it.Empty(contentType)
+	it.Nil(body)
+}
+
+func Test_ParseOpenAPIWithError(t *testing.T) {
+	it := assert.New(t)
+
+	_, err := ParseOpenAPI([]byte(`swagger: "2.0"`))
+	it.True(errors.Is(err, ErrOpenAPI))
+}
+
+func Test_MitmTransportMockOpenAPI(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	_, err := mt.MockOpenAPI("testdata/petstore.yaml", "")
+	it.Nil(err)
+
+	// overwrite an operation
+	mt.MockRequest("DELETE", "https://petstore.example.com/v1/pets/{petId}").WithResponse(404, nil, "")
+
+	response, err := http.Get("mitm://petstore.example.com/v1/pets/1")
+	it.Nil(err)
+	it.Equal(200, response.StatusCode)
+	it.Equal("application/json", response.Header.Get("Content-Type"))
+
+	b, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	it.Equal(`{"id":1,"name":"Doggie","tag":"dog"}`, string(b))
+
+	response, err = http.Post("mitm://petstore.example.com/v1/pets", "application/json", strings.NewReader(`{"name":"Kitty"}`))
+	it.Nil(err)
+	it.Equal(201, response.StatusCode)
+	response.Body.Close()
+
+	request, _ := http.NewRequest("DELETE", "mitm://petstore.example.com/v1/pets/1", nil)
+	response, err = http.DefaultClient.Do(request)
+	it.Nil(err)
+	it.Equal(404, response.StatusCode)
+}
+
+func Test_MitmTransportMockOpenAPIWithStringExample(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	filename := filepath.Join(t.TempDir(), "status.yaml")
+	it.Nil(os.WriteFile(filename, []byte(`openapi: 3.0.3
+info:
+  title: Status
+  version: 1.0.0
+servers:
+  - url: https://status.example.com
+paths:
+  /status:
+    get:
+      responses:
+        '200':
+          description: Status in json
+          content:
+            application/json:
+              example: ok
+  /ping:
+    get:
+      responses:
+        '200':
+          description: Status in text
+          content:
+            text/plain:
+              example: pong
+`), 0644))
+
+	_, err := mt.MockOpenAPI(filename, "")
+	it.Nil(err)
+
+	for rawurl, expected := range map[string]string{
+		"mitm://status.example.com/status": `"ok"`,
+		"mitm://status.example.com/ping":   `pong`,
+	} {
+		response, err := http.Get(rawurl)
+		it.Nil(err)
+		it.Equal(200, response.StatusCode)
+
+		b, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		it.Equal(expected, strings.TrimSpace(string(b)))
+	}
+}
+
+func Test_OpenAPIExampleWithEmptyStatus(t *testing.T) {
+	it := assert.New(t)
+
+	api, err := ParseOpenAPI([]byte(`openapi: 3.0.3
+info:
+  title: Empty
+  version: 1.0.0
+paths:
+  /items:
+    post:
+      operationId: createItem
+      responses:
+        '':
+          description: Empty status
+        '201':
+          description: Created
+`))
+	it.Nil(err)
+
+	code, _, body := api.Example(api.Operation("createItem"))
+	it.Equal(201, code)
+	it.Nil(body)
+}
@@ -0,0 +1,67 @@
+package httpmitm
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+type pathParamsKey struct{}
+
+// PathParams returns named params of request path matched by mocked path pattern, e.g. /user/{id}
+func PathParams(r *http.Request) map[string]string {
+	params, _ := r.Context().Value(pathParamsKey{}).(map[string]string)
+
+	return params
+}
+
+// PathParam returns value of named param of request path matched by mocked path pattern
+func PathParam(r *http.Request, name string) string {
+	return PathParams(r)[name]
+}
+
+// IsPathPattern returns true if urlpath contains named params, e.g. /user/{id}
+func IsPathPattern(urlpath string) bool {
+	return strings.Contains(urlpath, "{") && strings.Contains(urlpath, "}")
+}
+
+// MatchPathPattern resolves named params of urlpath by pattern, e.g. /user/{id} matches /user/1 with id=1
+// NOTE: it matches in case-insensitive, and ignores trailing slash.
+func MatchPathPattern(pattern, urlpath string) (params map[string]string, ok bool) {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(urlpath, "/"), "/")
+
+	if len(patternSegments) != len(pathSegments) {
+		return nil, false
+	}
+
+	params = make(map[string]string)
+	for i, segment := range patternSegments {
+		if name, ok := pathParamName(segment); ok {
+			if pathSegments[i] == "" {
+				return nil, false
+			}
+
+			params[name] = pathSegments[i]
+			continue
+		}
+
+		if !strings.EqualFold(segment, pathSegments[i]) {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+func pathParamName(segment string) (string, bool) {
+	if len(segment) > 2 && segment[0] == '{' && segment[len(segment)-1] == '}' {
+		return segment[1 : len(segment)-1], true
+	}
+
+	return "", false
+}
+
+func withPathParams(r *http.Request, params map[string]string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), pathParamsKey{}, params))
+}
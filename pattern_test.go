@@ -0,0 +1,44 @@
+package httpmitm
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_MatchPathPattern(t *testing.T) {
+	it := assert.New(t)
+
+	params, ok := MatchPathPattern("/user/{id}/posts/{post}", "/User/1/posts/2/")
+	it.True(ok)
+	it.Equal(map[string]string{"id": "1", "post": "2"}, params)
+
+	_, ok = MatchPathPattern("/user/{id}", "/user")
+	it.False(ok)
+
+	_, ok = MatchPathPattern("/user/{id}", "/users/1")
+	it.False(ok)
+}
+
+func Test_PathParam(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	// mocks
+	mt.MockRequest("GET", mockURL+"/user/{id}").WithCalleeResponse(func(r *http.Request) (int, http.Header, io.Reader, error) {
+		return 200, nil, strings.NewReader("user " + PathParam(r, "id")), nil
+	})
+
+	response, err := http.Get(stubURL + "/user/1")
+	it.Nil(err)
+	it.Equal(200, response.StatusCode)
+
+	b, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	it.Equal("user 1", string(b))
+}
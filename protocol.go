@@ -0,0 +1,219 @@
+package httpmitm
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Protocol versions of mocked responses
+const (
+	ProtoHTTP11 = "HTTP/1.1"
+	ProtoHTTP2  = "HTTP/2.0"
+)
+
+// WithProto apply protocol version of responses for current stub, it can be ProtoHTTP11 (default) or ProtoHTTP2.
+// NOTE: Responses of HTTP/2 are never chunked, and NegotiatedProtocol of TLS is h2 for https mocks.
+func (mitm *MitmTransport) WithProto(proto string) *MitmTransport {
+	if strings.EqualFold(proto, "HTTP/2") {
+		proto = ProtoHTTP2
+	}
+
+	major, _, ok := http.ParseHTTPVersion(proto)
+	if !ok || (major != 1 && major != 2) {
+		panic("invalid protocol version " + strconv.Quote(proto) + ". It must be HTTP/1.1 or HTTP/2.0")
+	}
+	if major == 2 {
+		proto = ProtoHTTP2
+	}
+
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	mitm.ensureChained()
+
+	mocker := mitm.lastMocker()
+	if mocker == nil {
+		panic(ErrResponse.Error())
+	}
+
+	mocker.SetProto(proto)
+
+	return mitm
+}
+
+// responseStatus returns status line of code without protocol, e.g. 200 OK
+func responseStatus(code int) string {
+	text := http.StatusText(code)
+	if text == "" {
+		text = "status code " + strconv.Itoa(code)
+	}
+
+	return strconv.Itoa(code) + " " + text
+}
+
+// normalizeResponse makes resp of mock the same as one read by net/http client, e.g. status text, protocol version,
+// Date header of clock, empty body of HEAD, 204 and 304, and trailers declared by Trailer header or keys prefixed with http.TrailerPrefix.
+func normalizeResponse(req *http.Request, resp *http.Response, proto string) {
+	if resp.Status == "" || resp.Status == strconv.Itoa(resp.StatusCode) {
+		resp.Status = responseStatus(resp.StatusCode)
+	}
+
+	if resp.Proto == "" {
+		if proto == "" {
+			proto = ProtoHTTP11
+		}
+
+		resp.Proto = proto
+		resp.ProtoMajor, resp.ProtoMinor, _ = http.ParseHTTPVersion(proto)
+	}
+
+	if resp.Request == nil {
+		resp.Request = req
+	}
+
+	header := ownHeader(resp)
+
+	if header.Get("Date") == "" {
+		header.Set("Date", RequestClock(req).Now().UTC().Format(http.TimeFormat))
+	}
+
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		return
+	}
+
+	trailer, values := splitTrailer(header)
+
+	switch {
+	case req != nil && req.Method == http.MethodHead:
+		closeBody(resp)
+
+		resp.ContentLength = -1
+		if n, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil {
+			resp.ContentLength = n
+		}
+
+		return
+
+	case resp.StatusCode/100 == 1, resp.StatusCode == http.StatusNoContent, resp.StatusCode == http.StatusNotModified:
+		closeBody(resp)
+
+		resp.ContentLength = 0
+
+		return
+	}
+
+	header.Del("Transfer-Encoding")
+
+	if len(trailer) > 0 {
+		resp.Trailer = trailer
+		resp.Body = &trailerBody{
+			ReadCloser: bodyOrEmpty(resp.Body),
+			trailer:    trailer,
+			values:     values,
+		}
+
+		if resp.ProtoMajor == 1 {
+			resp.ContentLength = -1
+		}
+	}
+
+	if resp.ProtoMajor != 1 {
+		resp.TransferEncoding = nil
+		return
+	}
+
+	if resp.ContentLength < 0 && !resp.Uncompressed {
+		header.Del("Content-Length")
+
+		resp.TransferEncoding = []string{"chunked"}
+	}
+}
+
+// splitTrailer removes trailers from header, and returns keys of trailers with their values
+func splitTrailer(header http.Header) (trailer, values http.Header) {
+	trailer = http.Header{}
+	values = http.Header{}
+
+	for _, value := range header.Values("Trailer") {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+
+			trailer[name] = nil
+			if v, ok := header[name]; ok {
+				values[name] = v
+				delete(header, name)
+			}
+		}
+	}
+	header.Del("Trailer")
+
+	for key, v := range header {
+		if !strings.HasPrefix(key, http.TrailerPrefix) {
+			continue
+		}
+
+		name := http.CanonicalHeaderKey(strings.TrimPrefix(key, http.TrailerPrefix))
+
+		trailer[name] = nil
+		values[name] = v
+		delete(header, key)
+	}
+
+	return
+}
+
+// ownHeader replaces header of resp with a copy and returns it, since header of responder is shared between responses.
+func ownHeader(resp *http.Response) http.Header {
+	resp.Header = resp.Header.Clone()
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+
+	return resp.Header
+}
+
+func closeBody(resp *http.Response) {
+	if resp.Body != nil && resp.Body != http.NoBody {
+		resp.Body.Close()
+	}
+
+	resp.Body = http.NoBody
+	resp.Trailer = nil
+	resp.TransferEncoding = nil
+}
+
+func bodyOrEmpty(body io.ReadCloser) io.ReadCloser {
+	if body == nil {
+		return http.NoBody
+	}
+
+	return body
+}
+
+// trailerBody fills values of trailer after body read to EOF, which is the same as net/http client.
+type trailerBody struct {
+	io.ReadCloser
+
+	once    sync.Once
+	trailer http.Header
+	values  http.Header
+}
+
+func (b *trailerBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(func() {
+			for key, v := range b.values {
+				b.trailer[key] = v
+			}
+		})
+	}
+
+	return n, err
+}
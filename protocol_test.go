@@ -0,0 +1,161 @@
+package httpmitm
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+)
+
+func Test_MitmTransportWithProto(t *testing.T) {
+	mt := NewMitmTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, nil, "[]").AnyTimes()
+	mt.MockRequest("GET", "https://api.example.com/orders").WithResponse(201, nil, "[]").WithProto("HTTP/2")
+	mt.MockRequest("GET", "https://api.example.com/events").WithChunkedResponse(200, nil, time.Millisecond, []byte("a"), []byte("b")).WithProto(ProtoHTTP2)
+
+	client := &http.Client{Transport: mt}
+
+	response, err := client.Get("mitm://api.example.com/users")
+	if it.Nil(err) {
+		response.Body.Close()
+
+		it.Equal("200 OK", response.Status)
+		it.Equal("HTTP/1.1", response.Proto)
+		it.Equal(1, response.ProtoMajor)
+		it.Equal(1, response.ProtoMinor)
+		it.Equal(int64(2), response.ContentLength)
+		it.Nil(response.TransferEncoding)
+		it.Equal("http/1.1", response.TLS.NegotiatedProtocol)
+	}
+
+	response, err = client.Get("mitm://api.example.com/orders")
+	if it.Nil(err) {
+		response.Body.Close()
+
+		it.Equal("201 Created", response.Status)
+		it.Equal("HTTP/2.0", response.Proto)
+		it.Equal(2, response.ProtoMajor)
+		it.Equal(0, response.ProtoMinor)
+		it.Equal("h2", response.TLS.NegotiatedProtocol)
+	}
+
+	response, err = client.Get("mitm://api.example.com/events")
+	if it.Nil(err) {
+		data, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+
+		it.Equal("ab", string(data))
+		it.Equal(int64(-1), response.ContentLength)
+		it.Nil(response.TransferEncoding)
+	}
+
+	it.Panics(func() {
+		mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, nil, "").WithProto("SPDY/3")
+	})
+}
+
+func Test_MitmTransportWithoutBody(t *testing.T) {
+	mt := NewMitmTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("HEAD", "https://api.example.com/users").WithResponse(200, nil, "[1,2,3]")
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponse(304, http.Header{"Etag": {`"v1"`}}, "[1,2,3]")
+	mt.MockRequest("GET", "https://api.example.com/status").WithResponse(599, nil, "")
+
+	client := &http.Client{Transport: mt}
+
+	response, err := client.Head("mitm://api.example.com/users")
+	if it.Nil(err) {
+		data, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+
+		it.Empty(data)
+		it.Equal(http.NoBody, response.Body)
+		it.Equal(int64(7), response.ContentLength)
+		it.Equal("7", response.Header.Get("Content-Length"))
+	}
+
+	response, err = client.Get("mitm://api.example.com/users")
+	if it.Nil(err) {
+		data, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+
+		it.Empty(data)
+		it.Equal("304 Not Modified", response.Status)
+		it.Equal(int64(0), response.ContentLength)
+		it.Equal(`"v1"`, response.Header.Get("Etag"))
+	}
+
+	response, err = client.Get("mitm://api.example.com/status")
+	if it.Nil(err) {
+		response.Body.Close()
+
+		it.Equal("599 status code 599", response.Status)
+	}
+}
+
+func Test_MitmTransportWithTrailer(t *testing.T) {
+	mt := NewMitmTransport()
+
+	it := assert.New(t)
+
+	header := http.Header{}
+	header.Set("Trailer", "X-Checksum")
+	header.Set("X-Checksum", "abc")
+	header.Set(http.TrailerPrefix+"X-Elapsed", "10ms")
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, header, "[]").AnyTimes()
+
+	client := &http.Client{Transport: mt}
+
+	for i := 0; i < 2; i++ {
+		response, err := client.Get("mitm://api.example.com/users")
+		if !it.Nil(err) {
+			continue
+		}
+
+		it.Equal(http.Header{"X-Checksum": nil, "X-Elapsed": nil}, response.Trailer)
+		it.Empty(response.Header.Get("Trailer"))
+		it.Empty(response.Header.Get("X-Checksum"))
+		it.Empty(response.Header.Get("Content-Length"))
+		it.Equal(int64(-1), response.ContentLength)
+		it.Equal([]string{"chunked"}, response.TransferEncoding)
+
+		data, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+
+		it.Equal("[]", string(data))
+		it.Equal("abc", response.Trailer.Get("X-Checksum"))
+		it.Equal("10ms", response.Trailer.Get("X-Elapsed"))
+	}
+}
+
+func Test_MitmHandlerWithTrailer(t *testing.T) {
+	mt := NewMitmTransport()
+
+	it := assert.New(t)
+
+	header := http.Header{}
+	header.Set(http.TrailerPrefix+"X-Checksum", "abc")
+
+	mt.MockRequest("GET", "http://api.example.com/users").WithResponse(200, header, "[]")
+
+	srv := httptest.NewServer(mt.Handler().WithDefaultHost("api.example.com"))
+	defer srv.Close()
+
+	response, err := http.Get(srv.URL + "/users")
+	if it.Nil(err) {
+		data, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+
+		it.Equal("[]", string(data))
+		it.Equal("abc", response.Trailer.Get("X-Checksum"))
+	}
+}
@@ -0,0 +1,379 @@
+package httpmitm
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MitmProxyHandler implements http.Handler of a forward http proxy backed by stubs of MitmTransport,
+// which accepts HTTP_PROXY and HTTPS_PROXY traffic. CONNECT requests of mocked hosts are intercepted by
+// terminating TLS with leaf certificates minted from its CA, other traffic is passed through to the origin.
+type MitmProxyHandler struct {
+	mux sync.Mutex
+
+	mitm       *MitmTransport
+	handler    *MitmHandler
+	ca         *CertificateAuthority
+	middleware func(http.Handler) http.Handler
+	conns      map[net.Conn]struct{}
+	closed     bool
+}
+
+// ProxyHandler returns *MitmProxyHandler of stubs, a new CA is generated if ca is nil.
+func (mitm *MitmTransport) ProxyHandler(ca *CertificateAuthority) (*MitmProxyHandler, error) {
+	if ca == nil {
+		var err error
+
+		ca, err = NewCertificateAuthority()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	handler := mitm.Handler().WithPassthrough(&http.Transport{
+		Proxy:                 nil,
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	})
+	handler.proxied = true
+
+	return &MitmProxyHandler{
+		mitm:    mitm,
+		handler: handler,
+		ca:      ca,
+		conns:   make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// CA returns *CertificateAuthority of the proxy
+func (proxy *MitmProxyHandler) CA() *CertificateAuthority {
+	return proxy.ca
+}
+
+// WithPassthrough changes http.RoundTripper of unmatched traffic, it defaults to a direct http.Transport.
+// NOTE: Tunnels of CONNECT requests to unmocked hosts are always dialed directly.
+func (proxy *MitmProxyHandler) WithPassthrough(rt http.RoundTripper) *MitmProxyHandler {
+	proxy.handler.WithPassthrough(rt)
+
+	return proxy
+}
+
+// WithMiddleware wraps handler of requests decrypted from CONNECT tunnels, e.g. for logging.
+func (proxy *MitmProxyHandler) WithMiddleware(middleware func(http.Handler) http.Handler) *MitmProxyHandler {
+	proxy.mux.Lock()
+	defer proxy.mux.Unlock()
+
+	proxy.middleware = middleware
+
+	return proxy
+}
+
+// Close closes all intercepted and tunneled connections, connections of later CONNECT requests are closed immediately.
+func (proxy *MitmProxyHandler) Close() {
+	proxy.mux.Lock()
+	defer proxy.mux.Unlock()
+
+	proxy.closed = true
+
+	for conn := range proxy.conns {
+		conn.Close()
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (proxy *MitmProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		proxy.serveConnect(w, r)
+		return
+	}
+
+	if !r.URL.IsAbs() {
+		http.Error(w, "absolute url of proxy request is required", http.StatusBadRequest)
+		return
+	}
+
+	proxy.serve(w, r, r.URL.Scheme, r.URL.Host)
+}
+
+// serve dispatches r to stubs if it's mocked, otherwise passes it through to the origin
+func (proxy *MitmProxyHandler) serve(w http.ResponseWriter, r *http.Request, scheme, host string) {
+	removeHopHeaders(r.Header)
+
+	if mocked := proxy.handler.matchedHost(r, host); mocked != "" {
+		proxy.handler.serve(w, r, mocked)
+		return
+	}
+
+	proxy.handler.forward(w, r, scheme, host)
+}
+
+// serveConnect intercepts TLS of mocked host, or tunnels the connection to the origin
+func (proxy *MitmProxyHandler) serveConnect(w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, ErrUnsupported.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	host := r.Host
+
+	var upstream net.Conn
+	if !proxy.isHostMocked(host) {
+		var err error
+
+		upstream, err = net.DialTimeout("tcp", host, 30*time.Second)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		if upstream != nil {
+			upstream.Close()
+		}
+
+		return
+	}
+
+	proxy.track(conn, true)
+	defer proxy.track(conn, false)
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		return
+	}
+
+	client := net.Conn(bufferedConn{conn, rw.Reader})
+
+	if upstream != nil {
+		proxy.track(upstream, true)
+		defer proxy.track(upstream, false)
+
+		tunnel(client, upstream)
+		return
+	}
+
+	tlsConn := tls.Server(client, proxy.ca.TLSConfig(host))
+	if err := tlsConn.Handshake(); err != nil {
+		return
+	}
+
+	hostname := host
+	if name, port, err := net.SplitHostPort(host); err == nil && port == "443" {
+		hostname = name
+	}
+
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxy.serve(w, r, "https", hostname)
+	})
+
+	proxy.mux.Lock()
+	if proxy.middleware != nil {
+		handler = proxy.middleware(handler)
+	}
+	proxy.mux.Unlock()
+
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	server.Serve(newConnListener(tlsConn))
+}
+
+// isHostMocked returns true if there is any stub registered for host with or without port
+func (proxy *MitmProxyHandler) isHostMocked(host string) bool {
+	mitm := proxy.mitm
+
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	for _, candidate := range hostCandidates(host) {
+		if mitm.isHostMocked(candidate) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (proxy *MitmProxyHandler) track(conn net.Conn, active bool) {
+	proxy.mux.Lock()
+	defer proxy.mux.Unlock()
+
+	if active {
+		if proxy.closed {
+			conn.Close()
+			return
+		}
+
+		proxy.conns[conn] = struct{}{}
+	} else {
+		delete(proxy.conns, conn)
+	}
+}
+
+// MitmProxy is a forward http proxy listening on a loopback address, see MitmProxyHandler for details.
+type MitmProxy struct {
+	*httptest.Server
+	*MitmProxyHandler
+}
+
+// Proxy starts *MitmProxy listening on a loopback address, the caller should call Close when finished.
+// A new CA is generated if ca is nil, clients should trust it with ca.CertPool() or ca.CertPEM(), e.g.
+//
+//	proxy, _ := mt.Proxy(nil)
+//	defer proxy.Close()
+//
+//	cmd := exec.Command("./app")
+//	cmd.Env = append(os.Environ(), proxy.Environ()...)
+func (mitm *MitmTransport) Proxy(ca *CertificateAuthority) (*MitmProxy, error) {
+	handler, err := mitm.ProxyHandler(ca)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MitmProxy{
+		Server:           httptest.NewServer(handler),
+		MitmProxyHandler: handler,
+	}, nil
+}
+
+// WithPassthrough changes http.RoundTripper of unmatched traffic, it defaults to a direct http.Transport.
+func (proxy *MitmProxy) WithPassthrough(rt http.RoundTripper) *MitmProxy {
+	proxy.MitmProxyHandler.WithPassthrough(rt)
+
+	return proxy
+}
+
+// Environ returns proxy environments for subprocess
+func (proxy *MitmProxy) Environ() []string {
+	return []string{
+		"HTTP_PROXY=" + proxy.URL,
+		"HTTPS_PROXY=" + proxy.URL,
+		"http_proxy=" + proxy.URL,
+		"https_proxy=" + proxy.URL,
+	}
+}
+
+// Close shuts down the proxy and closes all intercepted and tunneled connections
+func (proxy *MitmProxy) Close() {
+	proxy.MitmProxyHandler.Close()
+	proxy.Server.Close()
+}
+
+// tunnel copies data between client and upstream until either is closed
+func tunnel(client, upstream net.Conn) {
+	done := make(chan struct{}, 2)
+
+	pipe := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		dst.Close()
+
+		done <- struct{}{}
+	}
+
+	go pipe(upstream, client)
+	go pipe(client, upstream)
+
+	<-done
+	<-done
+}
+
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// removeHopHeaders removes hop-by-hop headers, which are not forwarded by proxy
+func removeHopHeaders(header http.Header) {
+	// keep upgrade handshake, e.g. WebSocket
+	if headerContainsToken(header, "Connection", "upgrade") {
+		header.Del("Proxy-Connection")
+		return
+	}
+
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			header.Del(strings.TrimSpace(name))
+		}
+	}
+
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+// connListener implements net.Listener of a single connection, Accept blocks until the connection closed.
+type connListener struct {
+	conn net.Conn
+	once sync.Once
+	done chan struct{}
+}
+
+func newConnListener(conn net.Conn) *connListener {
+	l := &connListener{
+		done: make(chan struct{}),
+	}
+	l.conn = &notifyConn{Conn: conn, close: l.Close}
+
+	return l
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	conn := l.conn
+	if conn != nil {
+		l.conn = nil
+
+		return conn, nil
+	}
+
+	<-l.done
+
+	return nil, net.ErrClosed
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return dummyAddr("mitm")
+}
+
+// notifyConn invokes close after the connection closed
+type notifyConn struct {
+	net.Conn
+
+	close func() error
+}
+
+func (c *notifyConn) Close() error {
+	err := c.Conn.Close()
+	c.close()
+
+	return err
+}
+
+type dummyAddr string
+
+func (a dummyAddr) Network() string {
+	return string(a)
+}
+
+func (a dummyAddr) String() string {
+	return string(a)
+}
@@ -0,0 +1,117 @@
+package httpmitm
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_MitmTransportProxy(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, nil, "users").Times(2)
+	mt.MockRequest("GET", "http://www.example.com").WithResponse(200, nil, "www")
+	mt.MockRequest("GET", "https://api.example.com/old").WithRedirectResponse(302, "https://api.example.com/users")
+
+	proxy, err := mt.Proxy(nil)
+	if !it.Nil(err) {
+		return
+	}
+	defer proxy.Close()
+
+	var passed []string
+	proxy.WithPassthrough(NewCalleeResponder(func(r *http.Request) (int, http.Header, io.Reader, error) {
+		passed = append(passed, r.URL.String())
+
+		return 200, http.Header{"Connection": []string{"close"}}, strings.NewReader("passed"), nil
+	}))
+
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyURL(proxyURL),
+			TLSClientConfig: &tls.Config{
+				RootCAs: proxy.CA().CertPool(),
+			},
+		},
+	}
+
+	// intercepted CONNECT
+	response, err := client.Get("https://api.example.com/old")
+	if it.Nil(err) {
+		it.Equal(200, response.StatusCode)
+		it.Equal("https://api.example.com/users", response.Request.URL.String())
+		it.NotNil(response.TLS)
+
+		b, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		it.Equal("users", string(b))
+	}
+
+	response, err = client.Get("https://api.example.com/users")
+	if it.Nil(err) {
+		response.Body.Close()
+	}
+
+	// plain http proxy
+	response, err = client.Get("http://www.example.com")
+	if it.Nil(err) {
+		b, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		it.Equal("www", string(b))
+	}
+
+	// pass through unmatched requests of both intercepted and plain hosts
+	for _, rawurl := range []string{"https://api.example.com/unmatched", "http://www.example.com/unmatched"} {
+		response, err = client.Get(rawurl)
+		if it.Nil(err) {
+			it.Equal(200, response.StatusCode)
+			it.Empty(response.Header.Get("Connection"))
+			response.Body.Close()
+		}
+	}
+	it.Equal([]string{"https://api.example.com/unmatched", "http://www.example.com/unmatched"}, passed)
+}
+
+func Test_MitmTransportProxyWithTunnel(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("origin"))
+	}))
+	defer origin.Close()
+
+	proxy, err := mt.Proxy(nil)
+	if !it.Nil(err) {
+		return
+	}
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	transport := origin.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+
+	// unmocked host is tunneled with certificate of origin
+	response, err := (&http.Client{Transport: transport}).Get(origin.URL)
+	if it.Nil(err) {
+		b, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		it.Equal("origin", string(b))
+	}
+
+	it.Contains(proxy.Environ(), "HTTPS_PROXY="+proxy.URL)
+}
@@ -0,0 +1,181 @@
+package httpmitm
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitKeyFunc returns key of request which is limited separately
+type RateLimitKeyFunc func(r *http.Request) string
+
+// RateLimitByHost limits requests per host, it's the default.
+func RateLimitByHost(r *http.Request) string {
+	return strings.ToLower(r.URL.Host)
+}
+
+// RateLimitByPath limits requests per host and path
+func RateLimitByPath(r *http.Request) string {
+	return strings.ToLower(r.URL.Host) + r.URL.Path
+}
+
+// RateLimitByHeader limits requests per value of header name, e.g. X-Api-Key
+func RateLimitByHeader(name string) RateLimitKeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// RateLimitResponder responds with wrapped responder for limit requests per window of each key,
+// and responds with 429 and Retry-After header beyond that. All responses have X-RateLimit-* headers.
+type RateLimitResponder struct {
+	mux sync.Mutex
+
+	responder http.RoundTripper
+	limit     int
+	window    time.Duration
+	key       RateLimitKeyFunc
+	clock     Clock // nil for clock of request
+	windows   map[string]*rateLimitWindow
+}
+
+type rateLimitWindow struct {
+	start time.Time
+	count int
+}
+
+// NewRateLimitResponder returns RateLimitResponder which allows limit requests per window of each host
+func NewRateLimitResponder(responder http.RoundTripper, limit int, window time.Duration) *RateLimitResponder {
+	return &RateLimitResponder{
+		responder: responder,
+		limit:     limit,
+		window:    window,
+		key:       RateLimitByHost,
+		windows:   make(map[string]*rateLimitWindow),
+	}
+}
+
+// WithKey limits requests per key returned by key func
+func (rl *RateLimitResponder) WithKey(key RateLimitKeyFunc) *RateLimitResponder {
+	rl.mux.Lock()
+	defer rl.mux.Unlock()
+
+	rl.key = key
+
+	return rl
+}
+
+// WithClock applies clock of windows, it's clock of MitmTransport by default, see MitmTransport.WithClock for details.
+func (rl *RateLimitResponder) WithClock(clock Clock) *RateLimitResponder {
+	rl.mux.Lock()
+	defer rl.mux.Unlock()
+
+	rl.clock = clock
+
+	return rl
+}
+
+// Reset removes all windows
+func (rl *RateLimitResponder) Reset() {
+	rl.mux.Lock()
+	defer rl.mux.Unlock()
+
+	rl.windows = make(map[string]*rateLimitWindow)
+}
+
+// RoundTrip implements http.RoundTripper
+func (rl *RateLimitResponder) RoundTrip(req *http.Request) (*http.Response, error) {
+	allowed, remaining, reset, retryAfter := rl.take(req)
+
+	header := http.Header{}
+	header.Set("X-RateLimit-Limit", strconv.Itoa(rl.limit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+	if !allowed {
+		body := http.StatusText(http.StatusTooManyRequests)
+
+		header.Set("Retry-After", strconv.FormatInt(int64(retryAfter/time.Second), 10))
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+
+		return &http.Response{
+			Status:        responseStatus(http.StatusTooManyRequests),
+			StatusCode:    http.StatusTooManyRequests,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+
+	response, err := rl.responder.RoundTrip(req)
+	if err != nil || response == nil {
+		return response, err
+	}
+
+	responseHeader := ownHeader(response)
+	for key, values := range header {
+		responseHeader[key] = values
+	}
+
+	return response, nil
+}
+
+// take consumes a request of window, and returns remaining requests with reset time of the window.
+// NOTE: retryAfter is rounded up to seconds, at least 1s.
+func (rl *RateLimitResponder) take(req *http.Request) (allowed bool, remaining int, reset time.Time, retryAfter time.Duration) {
+	rl.mux.Lock()
+	defer rl.mux.Unlock()
+
+	clock := rl.clock
+	if clock == nil {
+		clock = RequestClock(req)
+	}
+
+	now := clock.Now()
+	key := rl.key(req)
+
+	window, ok := rl.windows[key]
+	if !ok || !now.Before(window.start.Add(rl.window)) {
+		window = &rateLimitWindow{
+			start: now,
+		}
+		rl.windows[key] = window
+	}
+	reset = window.start.Add(rl.window)
+
+	if window.count >= rl.limit {
+		retryAfter = reset.Sub(now).Truncate(time.Second)
+		if retryAfter < reset.Sub(now) {
+			retryAfter += time.Second
+		}
+
+		return false, 0, reset, retryAfter
+	}
+
+	window.count++
+
+	return true, rl.limit - window.count, reset, 0
+}
+
+// WithRateLimit allows limit requests per window of each host for current stub, and responds with 429 beyond that.
+// NOTE: Use NewRateLimitResponder for limits per path or header.
+func (mitm *MitmTransport) WithRateLimit(limit int, window time.Duration) *MitmTransport {
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	mitm.ensureChained()
+
+	mocker := mitm.lastMocker()
+	if mocker == nil {
+		panic(ErrResponse.Error())
+	}
+
+	mocker.SetResponder(NewRateLimitResponder(mocker.Responder(), limit, window))
+
+	return mitm
+}
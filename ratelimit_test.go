@@ -0,0 +1,131 @@
+package httpmitm
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+)
+
+func Test_RateLimitResponder(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+
+	responder := NewRateLimitResponder(NewResponder(200, http.Header{"X-Custom": {"1"}}, "OK"), 2, time.Minute).WithClock(clock)
+
+	mt := NewMitmTransport()
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponser(responder).AnyTimes()
+
+	it := assert.New(t)
+
+	client := &http.Client{Transport: mt}
+
+	for i := 0; i < 2; i++ {
+		response, err := client.Get("mitm://api.example.com/users")
+		if it.Nil(err) {
+			response.Body.Close()
+
+			it.Equal(200, response.StatusCode)
+			it.Equal("1", response.Header.Get("X-Custom"))
+			it.Equal("2", response.Header.Get("X-RateLimit-Limit"))
+			it.Equal(strconv.Itoa(1-i), response.Header.Get("X-RateLimit-Remaining"))
+			it.Equal("1700000060", response.Header.Get("X-RateLimit-Reset"))
+			it.Empty(response.Header.Get("Retry-After"))
+		}
+	}
+
+	clock.Advance(30*time.Second + time.Millisecond)
+
+	response, err := client.Get("mitm://api.example.com/users")
+	if it.Nil(err) {
+		response.Body.Close()
+
+		it.Equal(http.StatusTooManyRequests, response.StatusCode)
+		it.Equal("429 Too Many Requests", response.Status)
+		it.Equal("30", response.Header.Get("Retry-After"))
+		it.Equal("0", response.Header.Get("X-RateLimit-Remaining"))
+		it.Equal("1700000060", response.Header.Get("X-RateLimit-Reset"))
+	}
+
+	// new window
+	clock.Advance(30 * time.Second)
+
+	response, err = client.Get("mitm://api.example.com/users")
+	if it.Nil(err) {
+		response.Body.Close()
+
+		it.Equal(200, response.StatusCode)
+		it.Equal("1", response.Header.Get("X-RateLimit-Remaining"))
+	}
+}
+
+func Test_RateLimitResponderWithKey(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+
+	responder := NewRateLimitResponder(NewResponder(200, nil, "OK"), 1, time.Second).
+		WithKey(RateLimitByHeader("X-Api-Key")).
+		WithClock(clock)
+
+	it := assert.New(t)
+
+	issue := func(key string) int {
+		request, _ := http.NewRequest("GET", "mitm://api.example.com/users", nil)
+		request.Header.Set("X-Api-Key", key)
+
+		response, err := responder.RoundTrip(request)
+		if !it.Nil(err) {
+			return 0
+		}
+		response.Body.Close()
+
+		return response.StatusCode
+	}
+
+	it.Equal(200, issue("a"))
+	it.Equal(200, issue("b"))
+	it.Equal(429, issue("a"))
+
+	responder.Reset()
+	it.Equal(200, issue("a"))
+}
+
+func Test_MitmTransportWithRateLimit(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+
+	mt := NewMitmTransport().WithClock(clock)
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, nil, "OK").WithRateLimit(1, time.Hour).AnyTimes()
+
+	client := &http.Client{Transport: mt}
+
+	for _, code := range []int{200, 429} {
+		response, err := client.Get("mitm://api.example.com/users")
+		if it.Nil(err) {
+			response.Body.Close()
+
+			it.Equal(code, response.StatusCode)
+		}
+	}
+
+	// window of transport clock
+	clock.Advance(time.Hour)
+
+	response, err := client.Get("mitm://api.example.com/users")
+	if it.Nil(err) {
+		response.Body.Close()
+
+		it.Equal(200, response.StatusCode)
+	}
+
+	snapshot := mt.Snapshot()
+	if it.Equal(1, len(snapshot.Stubs)) {
+		it.Equal(200, snapshot.Stubs[0].Status)
+	}
+
+	it.Panics(func() {
+		NewMitmTransport().WithRateLimit(1, time.Second)
+	})
+}
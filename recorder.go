@@ -0,0 +1,134 @@
+package httpmitm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Recorder implements http.RoundTripper, which records real traffic as mock definitions, e.g. a cassette of unseen traffic.
+// The last exchange wins for requests with the same method and path, since mocks are replayed by path regardless of query.
+type Recorder struct {
+	mux sync.Mutex
+
+	transport http.RoundTripper
+	mocks     []*MockDefinition
+	indexes   map[string]int
+}
+
+// NewRecorder returns *Recorder sending requests with transport, it defaults to http.DefaultTransport if nil.
+func NewRecorder(transport http.RoundTripper) *Recorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return &Recorder{
+		transport: transport,
+		indexes:   make(map[string]int),
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (rec *Recorder) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := rec.transport.RoundTrip(r)
+	if err != nil {
+		return resp, err
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+
+	headers := map[string]string{}
+	for key, values := range resp.Header {
+		switch http.CanonicalHeaderKey(key) {
+		case "Content-Length", "Date", "Connection", "Keep-Alive", "Transfer-Encoding":
+			continue
+		}
+
+		headers[key] = strings.Join(values, ", ")
+	}
+
+	response := &ResponseDefinition{
+		Status:  resp.StatusCode,
+		Headers: headers,
+	}
+	if len(data) > 0 {
+		if utf8.Valid(data) {
+			response.Body = string(data)
+		} else {
+			response.Body = &yaml.Node{
+				Kind:  yaml.ScalarNode,
+				Tag:   "!!binary",
+				Value: base64.StdEncoding.EncodeToString(data),
+			}
+		}
+	}
+
+	// NOTE: query is part of definition url, which matches with DefaultMatcher
+	urlobj := *r.URL
+	urlobj.Fragment = ""
+
+	def := &MockDefinition{
+		Method:   r.Method,
+		URL:      urlobj.String(),
+		Times:    "any",
+		Response: response,
+	}
+
+	rec.mux.Lock()
+	defer rec.mux.Unlock()
+
+	key := def.key()
+	if i, ok := rec.indexes[key]; ok {
+		rec.mocks[i] = def
+	} else {
+		rec.indexes[key] = len(rec.mocks)
+		rec.mocks = append(rec.mocks, def)
+	}
+
+	return resp, nil
+}
+
+// Definitions returns all recorded mocks sorted by url and method
+func (rec *Recorder) Definitions() *Definitions {
+	rec.mux.Lock()
+	defer rec.mux.Unlock()
+
+	mocks := make([]*MockDefinition, len(rec.mocks))
+	copy(mocks, rec.mocks)
+
+	sort.SliceStable(mocks, func(i, j int) bool {
+		if mocks[i].URL != mocks[j].URL {
+			return mocks[i].URL < mocks[j].URL
+		}
+
+		return mocks[i].Method < mocks[j].Method
+	})
+
+	return &Definitions{
+		Mocks: mocks,
+	}
+}
+
+// Save writes recorded mocks to filename in YAML format, which can be loaded with LoadDefinitions.
+func (rec *Recorder) Save(filename string) error {
+	var buf bytes.Buffer
+	if err := WriteDefinitions(&buf, rec.Definitions()); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, buf.Bytes(), 0644)
+}
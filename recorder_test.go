@@ -0,0 +1,90 @@
+package httpmitm
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_NewRecorder(t *testing.T) {
+	it := assert.New(t)
+
+	recorder := NewRecorder(NewResponder(200, http.Header{"Content-Type": []string{"text/plain"}}, "Hello, httpmitm!"))
+
+	for i := 0; i < 2; i++ {
+		request, _ := http.NewRequest("GET", "https://api.example.com/hello?name=mitm", nil)
+
+		response, err := recorder.RoundTrip(request)
+		if it.Nil(err) {
+			b, _ := io.ReadAll(response.Body)
+			response.Body.Close()
+			it.Equal("Hello, httpmitm!", string(b))
+		}
+	}
+
+	defs := recorder.Definitions()
+	if it.Equal(1, len(defs.Mocks)) {
+		def := defs.Mocks[0]
+		it.Equal("GET", def.Method)
+		it.Equal("https://api.example.com/hello?name=mitm", def.URL)
+		it.Equal("any", def.Times)
+		it.Equal(200, def.Response.Status)
+		it.Equal("text/plain", def.Response.Headers["Content-Type"])
+		it.Empty(def.Response.Headers["Content-Length"])
+		it.Equal("Hello, httpmitm!", def.Response.Body)
+	}
+}
+
+func Test_RecorderWithQuery(t *testing.T) {
+	it := assert.New(t)
+
+	recorder := NewRecorder(NewCalleeResponder(func(r *http.Request) (int, http.Header, io.Reader, error) {
+		return 200, nil, strings.NewReader("page " + r.URL.Query().Get("page")), nil
+	}))
+
+	for _, rawurl := range []string{"https://api.example.com/users?page=1", "https://api.example.com/users?page=2"} {
+		request, _ := http.NewRequest("GET", rawurl, nil)
+
+		_, err := recorder.RoundTrip(request)
+		it.Nil(err)
+	}
+
+	// replayed by path, the last exchange wins
+	defs := recorder.Definitions()
+	if it.Equal(1, len(defs.Mocks)) {
+		it.Equal("https://api.example.com/users?page=2", defs.Mocks[0].URL)
+		it.Equal("page 2", defs.Mocks[0].Response.Body)
+	}
+}
+
+func Test_RecorderSave(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	recorder := NewRecorder(NewResponder(201, nil, []byte{0xff, 0x00}))
+
+	request, _ := http.NewRequest("POST", "https://api.example.com/binary", nil)
+	_, err := recorder.RoundTrip(request)
+	it.Nil(err)
+
+	filename := filepath.Join(t.TempDir(), "cassette.yaml")
+	it.Nil(recorder.Save(filename))
+
+	// replay
+	it.Nil(mt.LoadDefinitions(filename))
+
+	response, err := http.Post("mitm://api.example.com/binary", "", nil)
+	if it.Nil(err) {
+		it.Equal(201, response.StatusCode)
+
+		b, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		it.Equal([]byte{0xff, 0x00}, b)
+	}
+}
@@ -0,0 +1,101 @@
+package httpmitm
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NewRedirectResponder returns Responder which redirects to location with code of 3xx
+func NewRedirectResponder(code int, location string) http.RoundTripper {
+	header := http.Header{}
+	header.Set("Location", location)
+
+	return NewResponder(code, header, "")
+}
+
+// WithRedirectResponse apply http redirect response to location for current stub
+func (mitm *MitmTransport) WithRedirectResponse(code int, location string) *MitmTransport {
+	return mitm.WithResponser(NewRedirectResponder(code, location))
+}
+
+// MockRedirectChain stubs a chain of redirects which each hop of urls redirects to the next one with related code.
+// It returns a chain of the last url, thus the final response can be applied as usual, e.g.
+//
+//	mt.MockRedirectChain("GET", []int{301, 302}, "https://a.example.com", "https://b.example.com", "https://c.example.com").WithResponse(200, nil, "OK")
+//
+// NOTE: the method of following hops is changed to GET for 301, 302 and 303 as http.Client does.
+func (mitm *MitmTransport) MockRedirectChain(method string, codes []int, urls ...string) *MitmTransport {
+	if len(urls) != len(codes)+1 {
+		panic(ErrRedirects.Error())
+	}
+
+	for i, code := range codes {
+		mitm.MockRequest(method, urls[i]).WithRedirectResponse(code, urls[i+1])
+
+		method = redirectMethod(method, code)
+	}
+
+	return mitm.MockRequest(method, urls[len(urls)-1])
+}
+
+// rewriteLocation adjusts Location header of redirect response to mitm scheme if its host is mocked,
+// thus http.Client follows the redirect within MitmTransport.
+func (mitm *MitmTransport) rewriteLocation(resp *http.Response) {
+	if resp == nil || resp.StatusCode/100 != 3 {
+		return
+	}
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return
+	}
+
+	urlobj, err := url.Parse(location)
+	if err != nil || !urlobj.IsAbs() {
+		return
+	}
+
+	switch strings.ToLower(urlobj.Scheme) {
+	case "http", "https":
+		mitm.mux.Lock()
+		mocked := mitm.isHostMocked(urlobj.Host)
+		mitm.mux.Unlock()
+
+		if !mocked {
+			return
+		}
+
+	default:
+		return
+	}
+
+	urlobj.Scheme = MockScheme
+
+	ownHeader(resp).Set("Location", urlobj.String())
+}
+
+// isHostMocked returns true if there is any stub registered for host
+// NOTE: caller must hold mitm.mux
+func (mitm *MitmTransport) isHostMocked(host string) bool {
+	suffix := " " + strings.TrimRight(strings.ToLower(MockScheme+"://"+host), "/")
+
+	for key := range mitm.stubs {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func redirectMethod(method string, code int) string {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther:
+		if method != http.MethodGet && method != http.MethodHead {
+			return http.MethodGet
+		}
+	}
+
+	return method
+}
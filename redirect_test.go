@@ -0,0 +1,74 @@
+package httpmitm
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_NewRedirectResponder(t *testing.T) {
+	it := assert.New(t)
+
+	responder := NewRedirectResponder(http.StatusFound, "https://example.com/next")
+	it.Implements((*http.RoundTripper)(nil), responder)
+
+	request, _ := http.NewRequest("GET", mockURL, nil)
+	response, err := responder.RoundTrip(request)
+	it.Nil(err)
+	it.Equal(http.StatusFound, response.StatusCode)
+	it.Equal("https://example.com/next", response.Header.Get("Location"))
+}
+
+func Test_MitmTransportMockRedirectChain(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	// mocks
+	mt.MockRedirectChain("POST", []int{301, 302},
+		"https://auth.example.com/authorize",
+		"https://auth.example.com/login",
+		"https://app.example.com/callback",
+	).WithResponse(200, nil, "LOGGED IN")
+
+	response, err := http.Post("mitm://auth.example.com/authorize", "text/plain", nil)
+	it.Nil(err)
+	it.Equal(200, response.StatusCode)
+	it.Equal("mitm://app.example.com/callback", response.Request.URL.String())
+
+	b, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	it.Equal("LOGGED IN", string(b))
+
+	// each hop is counted
+	for _, key := range []string{"POST mitm://auth.example.com", "GET mitm://auth.example.com", "GET mitm://app.example.com"} {
+		for _, mocker := range mt.stubs[key].Mocks() {
+			expected, invoked := mocker.Times()
+			it.Equal(expected, invoked)
+		}
+	}
+}
+
+func Test_MitmTransportWithRedirectToUnmocked(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	// mocks
+	mt.MockRequest("GET", "https://example.com/download").WithRedirectResponse(307, "https://cdn.example.com/file")
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	response, err := client.Get("mitm://example.com/download")
+	it.Nil(err)
+	it.Equal(307, response.StatusCode)
+	it.Equal("https://cdn.example.com/file", response.Header.Get("Location"))
+}
@@ -0,0 +1,330 @@
+package httpmitm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	ResourceIDKey = "id"
+
+	resourceItemParam = "id" // name of path param of item url, which is independent of id field of items
+)
+
+// Resource simulates a REST collection of JSON objects in memory.
+// NOTE: Resource implements http.RoundTripper for invocation chaining.
+type Resource struct {
+	mux sync.RWMutex
+
+	rawurl string
+	idKey  string
+	items  map[string]map[string]interface{}
+	nextID int64
+}
+
+// NewResource creates *Resource of collection url, e.g. https://api.example.com/v1/widgets
+func NewResource(rawurl string) *Resource {
+	return &Resource{
+		rawurl: strings.TrimRight(rawurl, "/"),
+		idKey:  ResourceIDKey,
+		items:  make(map[string]map[string]interface{}),
+		nextID: 1,
+	}
+}
+
+// MockResource stubs collection url and item url of the resource with all methods for any times, which supports
+//
+//	POST   /widgets      creates an item with new id, 201 or 409 for existed id
+//	GET    /widgets      lists items, paging with ?page=1&per_page=10
+//	GET    /widgets/{id} returns the item, 200 or 404
+//	PUT    /widgets/{id} replaces the item, 200 or 404
+//	PATCH  /widgets/{id} merges fields of the item, 200 or 404
+//	DELETE /widgets/{id} deletes the item, 204 or 404
+func (mitm *MitmTransport) MockResource(rawurl string) *Resource {
+	resource := NewResource(rawurl)
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		mitm.MockRequest(method, resource.rawurl).WithResponser(resource).AnyTimes()
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		mitm.MockRequest(method, resource.rawurl+"/{"+resourceItemParam+"}").WithResponser(resource).AnyTimes()
+	}
+
+	return resource
+}
+
+// WithIDKey changes field name of item id, it defaults to id
+func (res *Resource) WithIDKey(key string) *Resource {
+	res.mux.Lock()
+	defer res.mux.Unlock()
+
+	res.idKey = key
+
+	return res
+}
+
+// Seed adds items to the resource, it assigns new id for item without id.
+func (res *Resource) Seed(items ...map[string]interface{}) *Resource {
+	res.mux.Lock()
+	defer res.mux.Unlock()
+
+	for _, item := range items {
+		res.store(copyItem(item))
+	}
+
+	return res
+}
+
+// Items returns copy of all items sorted by id
+func (res *Resource) Items() []map[string]interface{} {
+	res.mux.RLock()
+	defer res.mux.RUnlock()
+
+	return res.list()
+}
+
+// Item returns copy of the item of id
+func (res *Resource) Item(id interface{}) (map[string]interface{}, bool) {
+	res.mux.RLock()
+	defer res.mux.RUnlock()
+
+	item, ok := res.items[fmt.Sprint(id)]
+	if !ok {
+		return nil, false
+	}
+
+	return copyItem(item), true
+}
+
+// Reset removes all items of the resource
+func (res *Resource) Reset() {
+	res.mux.Lock()
+	defer res.mux.Unlock()
+
+	res.items = make(map[string]map[string]interface{})
+	res.nextID = 1
+}
+
+// RoundTrip implements http.RoundTripper
+func (res *Resource) RoundTrip(req *http.Request) (*http.Response, error) {
+	res.mux.Lock()
+	defer res.mux.Unlock()
+
+	id := PathParam(req, resourceItemParam)
+
+	var (
+		code int
+		body interface{}
+	)
+	if id == "" {
+		code, body = res.serveCollection(req)
+	} else {
+		code, body = res.serveItem(req, id)
+	}
+
+	header := http.Header{}
+	if code == http.StatusCreated {
+		if item, ok := body.(map[string]interface{}); ok {
+			header.Set("Location", res.rawurl+"/"+fmt.Sprint(item[res.idKey]))
+		}
+	}
+
+	if code == http.StatusOK && id == "" {
+		header.Set("X-Total-Count", strconv.Itoa(len(res.items)))
+	}
+
+	if body == nil {
+		return NewResponder(code, header, "").RoundTrip(req)
+	}
+
+	return NewJsonResponder(code, header, body).RoundTrip(req)
+}
+
+func (res *Resource) serveCollection(req *http.Request) (int, interface{}) {
+	switch req.Method {
+	case http.MethodGet:
+		items := res.list()
+
+		query := req.URL.Query()
+
+		perPage, _ := strconv.Atoi(query.Get("per_page"))
+		if perPage > 0 {
+			page, _ := strconv.Atoi(query.Get("page"))
+			if page < 1 {
+				page = 1
+			}
+
+			offset := (page - 1) * perPage
+			switch {
+			case offset >= len(items):
+				items = items[:0]
+
+			case offset+perPage < len(items):
+				items = items[offset : offset+perPage]
+
+			default:
+				items = items[offset:]
+			}
+		}
+
+		return http.StatusOK, items
+
+	case http.MethodPost:
+		item, err := decodeItem(req)
+		if err != nil {
+			return http.StatusBadRequest, resourceError(err.Error())
+		}
+
+		if id, ok := item[res.idKey]; ok {
+			if !isResourceID(id) {
+				return http.StatusBadRequest, resourceError("invalid " + res.idKey)
+			}
+
+			if _, exists := res.items[fmt.Sprint(id)]; exists {
+				return http.StatusConflict, resourceError("conflict")
+			}
+		}
+
+		res.store(item)
+
+		return http.StatusCreated, copyItem(item)
+	}
+
+	return http.StatusMethodNotAllowed, resourceError("method not allowed")
+}
+
+func (res *Resource) serveItem(req *http.Request, id string) (int, interface{}) {
+	current, ok := res.items[id]
+	if !ok {
+		return http.StatusNotFound, resourceError("not found")
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		return http.StatusOK, copyItem(current)
+
+	case http.MethodPut, http.MethodPatch:
+		item, err := decodeItem(req)
+		if err != nil {
+			return http.StatusBadRequest, resourceError(err.Error())
+		}
+
+		// NOTE: id of item is immutable
+		itemID := current[res.idKey]
+
+		if req.Method == http.MethodPatch {
+			merged := copyItem(current)
+			for key, value := range item {
+				merged[key] = value
+			}
+
+			item = merged
+		}
+
+		item[res.idKey] = itemID
+		res.items[id] = item
+
+		return http.StatusOK, copyItem(item)
+
+	case http.MethodDelete:
+		delete(res.items, id)
+
+		return http.StatusNoContent, nil
+	}
+
+	return http.StatusMethodNotAllowed, resourceError("method not allowed")
+}
+
+// store adds item with new id if missing
+func (res *Resource) store(item map[string]interface{}) {
+	id, ok := item[res.idKey]
+	if !ok {
+		id = res.nextID
+		item[res.idKey] = id
+	}
+
+	// keep new id greater than numeric ids
+	if n, err := strconv.ParseInt(fmt.Sprint(id), 10, 64); err == nil && n >= res.nextID {
+		res.nextID = n + 1
+	}
+
+	res.items[fmt.Sprint(id)] = item
+}
+
+// list returns copy of all items sorted by id, numeric ids are sorted by number
+func (res *Resource) list() []map[string]interface{} {
+	keys := make([]string, 0, len(res.items))
+	for key := range res.items {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		ni, erri := strconv.ParseInt(keys[i], 10, 64)
+		nj, errj := strconv.ParseInt(keys[j], 10, 64)
+		if erri == nil && errj == nil {
+			return ni < nj
+		}
+
+		return keys[i] < keys[j]
+	})
+
+	items := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, copyItem(res.items[key]))
+	}
+
+	return items
+}
+
+func decodeItem(req *http.Request) (item map[string]interface{}, err error) {
+	if req.Body == nil {
+		return nil, io.EOF
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	decoder.UseNumber()
+
+	err = decoder.Decode(&item)
+	if err == nil && item == nil {
+		err = ErrUnsupported
+	}
+
+	return
+}
+
+// isResourceID returns true for id of integer or non-empty string
+func isResourceID(id interface{}) bool {
+	switch v := id.(type) {
+	case json.Number:
+		_, err := v.Int64()
+
+		return err == nil
+
+	case string:
+		return v != ""
+	}
+
+	return false
+}
+
+func copyItem(item map[string]interface{}) map[string]interface{} {
+	dup := make(map[string]interface{}, len(item))
+	for key, value := range item {
+		dup[key] = value
+	}
+
+	return dup
+}
+
+func resourceError(msg string) map[string]interface{} {
+	return map[string]interface{}{
+		"error": msg,
+	}
+}
@@ -0,0 +1,120 @@
+package httpmitm
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_MitmTransportMockResource(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	widgets := mt.MockResource("https://api.example.com/v1/widgets").Seed(
+		map[string]interface{}{"id": 1, "name": "first"},
+		map[string]interface{}{"id": 2, "name": "second"},
+	)
+
+	do := func(method, rawurl, body string) (int, string) {
+		request, _ := http.NewRequest(method, rawurl, strings.NewReader(body))
+
+		response, err := http.DefaultClient.Do(request)
+		it.Nil(err)
+
+		b, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+
+		return response.StatusCode, string(b)
+	}
+
+	// create
+	code, body := do("POST", "mitm://api.example.com/v1/widgets", `{"name":"third"}`)
+	it.Equal(http.StatusCreated, code)
+	it.Equal(`{"id":3,"name":"third"}`, body)
+
+	code, _ = do("POST", "mitm://api.example.com/v1/widgets", `{"id":1,"name":"dup"}`)
+	it.Equal(http.StatusConflict, code)
+
+	code, _ = do("POST", "mitm://api.example.com/v1/widgets", `invalid`)
+	it.Equal(http.StatusBadRequest, code)
+
+	code, _ = do("POST", "mitm://api.example.com/v1/widgets", `{"id":1.5,"name":"float"}`)
+	it.Equal(http.StatusBadRequest, code)
+
+	// list with pagination
+	code, body = do("GET", "mitm://api.example.com/v1/widgets?page=2&per_page=2", "")
+	it.Equal(http.StatusOK, code)
+
+	var items []map[string]interface{}
+	it.Nil(json.Unmarshal([]byte(body), &items))
+	it.Equal(1, len(items))
+	it.Equal("third", items[0]["name"])
+
+	// get, put, patch and delete
+	code, body = do("GET", "mitm://api.example.com/v1/widgets/2", "")
+	it.Equal(http.StatusOK, code)
+	it.Equal(`{"id":2,"name":"second"}`, body)
+
+	code, body = do("PUT", "mitm://api.example.com/v1/widgets/2", `{"id":9,"title":"replaced"}`)
+	it.Equal(http.StatusOK, code)
+	it.Equal(`{"id":2,"title":"replaced"}`, body)
+
+	code, body = do("PATCH", "mitm://api.example.com/v1/widgets/2", `{"name":"patched"}`)
+	it.Equal(http.StatusOK, code)
+	it.Equal(`{"id":2,"name":"patched","title":"replaced"}`, body)
+
+	code, body = do("PATCH", "mitm://api.example.com/v1/widgets/2", `{"id":99}`)
+	it.Equal(http.StatusOK, code)
+	it.Equal(`{"id":2,"name":"patched","title":"replaced"}`, body)
+
+	code, _ = do("GET", "mitm://api.example.com/v1/widgets/99", "")
+	it.Equal(http.StatusNotFound, code)
+
+	code, _ = do("DELETE", "mitm://api.example.com/v1/widgets/1", "")
+	it.Equal(http.StatusNoContent, code)
+
+	code, _ = do("GET", "mitm://api.example.com/v1/widgets/1", "")
+	it.Equal(http.StatusNotFound, code)
+
+	// inspect
+	it.Equal(2, len(widgets.Items()))
+
+	item, ok := widgets.Item(2)
+	it.True(ok)
+	it.Equal("patched", item["name"])
+}
+
+func Test_MitmTransportMockResourceWithIDKey(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	mt.MockResource("https://api.example.com/v1/widgets").WithIDKey("uuid").Seed(
+		map[string]interface{}{"uuid": "abc", "name": "first"},
+	)
+
+	response, err := http.Get("mitm://api.example.com/v1/widgets/abc")
+	if it.Nil(err) {
+		b, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+
+		it.Equal(http.StatusOK, response.StatusCode)
+		it.Equal(`{"name":"first","uuid":"abc"}`, string(b))
+	}
+
+	request, _ := http.NewRequest("DELETE", "mitm://api.example.com/v1/widgets/abc", nil)
+
+	response, err = http.DefaultClient.Do(request)
+	if it.Nil(err) {
+		response.Body.Close()
+
+		it.Equal(http.StatusNoContent, response.StatusCode)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync"
+	"time"
 )
 
 var (
@@ -15,6 +17,8 @@ var (
 // Responder defines response of mocked request
 // NOTE: Responder implements http.RoundTripper for invocation chaining.
 type Responder struct {
+	mux sync.Mutex
+
 	code   int
 	header http.Header
 	body   Testdataer
@@ -85,6 +89,9 @@ func NewCalleeResponder(callee func(r *http.Request) (code int, header http.Head
 }
 
 func (r *Responder) Write(method string, urlobj *url.URL, data []byte) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
 	key := r.body.Key(method, urlobj)
 
 	return r.body.Write(key, data)
@@ -92,52 +99,71 @@ func (r *Responder) Write(method string, urlobj *url.URL, data []byte) error {
 
 // RoundTrip implements http.RoundTripper
 func (r *Responder) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mux.Lock()
+	body, callee, err := r.body, r.callee, r.err
+	r.mux.Unlock()
+
 	// is there an error?
-	if r.err != nil {
-		return nil, r.err
+	if err != nil {
+		return nil, err
 	}
 
-	if r.body == nil {
+	if body == nil {
 		return nil, ErrResponse
 	}
 
-	key := r.body.Key(req.Method, req.URL)
-
 	// apply callee if exists
-	if r.callee != nil {
-		var (
-			reader io.Reader
-		)
-
-		r.code, r.header, reader, r.err = r.callee(req)
-		if r.err != nil {
-			return nil, r.err
+	// NOTE: callee is invoked without lock, which may wait for concurrent requests of the mock.
+	if callee != nil {
+		code, header, reader, err := callee(req)
+		if err != nil {
+			return nil, err
 		}
 
-		// sync reader data returned by callee to r.body
-		td, ok := r.body.(*Testdata)
-		if ok {
-			td.reader = reader
-		} else {
-			td, r.err = NewTestdataFromIface(reader)
-			if r.err != nil {
-				return nil, r.err
-			}
-
-			r.body = td
+		if header == nil {
+			header = http.Header{}
 		}
+
+		// NOTE: nil reader fails the same as empty testdata
+		if reader == nil {
+			return nil, io.EOF
+		}
+
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		// keep the latest result of callee, e.g. for writing back response of paused request
+		r.mux.Lock()
+		r.code, r.header = code, header
+		if td, ok := r.body.(*Testdata); ok {
+			td.reader = io.NopCloser(bytes.NewBuffer(data))
+		}
+		r.mux.Unlock()
+
+		return newResponderResponse(req, code, header, data), nil
 	}
 
-	data, err := r.body.Read(key)
+	// NOTE: body and header are shared between concurrent requests
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	data, err := body.Read(body.Key(req.Method, req.URL))
 	if err != nil {
 		return nil, err
 	}
 
+	return newResponderResponse(req, r.code, r.header, data), nil
+}
+
+// newResponderResponse returns response of data, it adds Content-Length header if missed.
+func newResponderResponse(req *http.Request, code int, header http.Header, data []byte) *http.Response {
 	// push back for response reader
 	response := &http.Response{
-		Status:     strconv.Itoa(r.code),
-		StatusCode: r.code,
-		Header:     r.header,
+		Status:     responseStatus(code),
+		StatusCode: code,
+		Header:     header,
 		Body:       io.NopCloser(bytes.NewReader(data)),
 		Request:    req,
 	}
@@ -148,7 +174,7 @@ func (r *Responder) RoundTrip(req *http.Request) (*http.Response, error) {
 	}
 	response.ContentLength, _ = strconv.ParseInt(response.Header.Get("Content-Length"), 10, 64)
 
-	return response, nil
+	return response
 }
 
 // NotFoundResponder represents a connection with 404 response.
@@ -185,3 +211,59 @@ func NewTimeoutResponder() *TimeoutResponder {
 func (t *TimeoutResponder) RoundTrip(req *http.Request) (*http.Response, error) {
 	return nil, ErrTimeout
 }
+
+// DelayResponder delays response of wrapped responder.
+type DelayResponder struct {
+	responder http.RoundTripper
+	delay     time.Duration
+}
+
+// NewDelayResponder returns DelayResponder which responds after delay, it aborts if request canceled.
+func NewDelayResponder(responder http.RoundTripper, delay time.Duration) *DelayResponder {
+	return &DelayResponder{
+		responder: responder,
+		delay:     delay,
+	}
+}
+
+func (d *DelayResponder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := sleepWithRequest(req, d.delay); err != nil {
+		return nil, err
+	}
+
+	return d.responder.RoundTrip(req)
+}
+
+// SequenceResponder responds with responders in order, the last one is repeated after all consumed.
+type SequenceResponder struct {
+	mux sync.Mutex
+
+	responders []http.RoundTripper
+	index      int
+}
+
+// NewSequenceResponder returns SequenceResponder of responders
+func NewSequenceResponder(responders ...http.RoundTripper) *SequenceResponder {
+	return &SequenceResponder{
+		responders: responders,
+	}
+}
+
+func (s *SequenceResponder) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.mux.Lock()
+
+	if len(s.responders) == 0 {
+		s.mux.Unlock()
+
+		return nil, ErrResponse
+	}
+
+	responder := s.responders[s.index]
+	if s.index < len(s.responders)-1 {
+		s.index++
+	}
+
+	s.mux.Unlock()
+
+	return responder.RoundTrip(req)
+}
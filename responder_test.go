@@ -1,12 +1,16 @@
 package httpmitm
 
 import (
+	"context"
 	"encoding/xml"
 	"io"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/golib/assert"
 )
@@ -231,3 +235,120 @@ func Test_NewCalleeResponderWithError(t *testing.T) {
 	it.EqualError(ErrUnsupported, err.Error())
 	it.Nil(response)
 }
+
+func Test_NewCalleeResponderWithErrorPerRequest(t *testing.T) {
+	it := assert.New(t)
+
+	var invoked int
+
+	responder := NewCalleeResponder(func(r *http.Request) (int, http.Header, io.Reader, error) {
+		invoked++
+		if invoked == 1 {
+			return 0, nil, nil, ErrUnsupported
+		}
+
+		return 200, nil, strings.NewReader("OK"), nil
+	})
+
+	request, _ := http.NewRequest("GET", mockURL, nil)
+
+	_, err := responder.RoundTrip(request)
+	it.Equal(ErrUnsupported, err)
+
+	response, err := responder.RoundTrip(request)
+	if it.Nil(err) {
+		b, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+
+		it.Equal(200, response.StatusCode)
+		it.Equal("OK", string(b))
+	}
+}
+
+func Test_MitmTransportWithConcurrentCallee(t *testing.T) {
+	mt := NewMitmTransport()
+
+	it := assert.New(t)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	// NOTE: callee waits for the other request, which deadlocks if callees are serialized
+	mt.MockRequest("GET", "https://api.example.com/users/{id}").WithCalleeResponse(func(r *http.Request) (int, http.Header, io.Reader, error) {
+		wg.Done()
+		wg.Wait()
+
+		return 200, nil, strings.NewReader(PathParam(r, "id")), nil
+	}).Times(2)
+
+	client := &http.Client{Transport: mt}
+
+	bodies := make(chan string, 2)
+	for _, id := range []string{"1", "2"} {
+		go func(id string) {
+			response, err := client.Get("mitm://api.example.com/users/" + id)
+			if err != nil {
+				bodies <- err.Error()
+				return
+			}
+
+			b, _ := io.ReadAll(response.Body)
+			response.Body.Close()
+
+			bodies <- string(b)
+		}(id)
+	}
+
+	var results []string
+	for len(results) < 2 {
+		select {
+		case body := <-bodies:
+			results = append(results, body)
+
+		case <-time.After(time.Second):
+			t.Fatal("concurrent requests of callee are serialized")
+		}
+	}
+
+	sort.Strings(results)
+	it.Equal([]string{"1", "2"}, results)
+}
+
+func Test_NewDelayResponder(t *testing.T) {
+	it := assert.New(t)
+
+	responder := NewDelayResponder(NewResponder(200, nil, "OK"), 20*time.Millisecond)
+
+	request, _ := http.NewRequest("GET", mockURL, nil)
+
+	start := time.Now()
+	response, err := responder.RoundTrip(request)
+	it.Nil(err)
+	it.Equal(200, response.StatusCode)
+	it.True(time.Since(start) >= 20*time.Millisecond)
+
+	// canceled request
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	response, err = responder.RoundTrip(request.WithContext(ctx))
+	it.NotNil(err)
+	it.Nil(response)
+}
+
+func Test_NewSequenceResponder(t *testing.T) {
+	it := assert.New(t)
+
+	responder := NewSequenceResponder(NewResponder(503, nil, ""), NewResponder(200, nil, ""))
+
+	request, _ := http.NewRequest("GET", mockURL, nil)
+
+	for _, code := range []int{503, 200, 200} {
+		response, err := responder.RoundTrip(request)
+		it.Nil(err)
+		it.Equal(code, response.StatusCode)
+	}
+
+	_, err := NewSequenceResponder().RoundTrip(request)
+	it.Equal(ErrResponse, err)
+}
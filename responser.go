@@ -31,12 +31,52 @@ func NewResponser(responder http.RoundTripper, rawurl string, times int) *Respon
 // New registers a mocker to *Responser with rawurl's path.
 // NOTE: it may overwrite existed mocker with the same request path.
 func (r *Responser) New(responder http.RoundTripper, rawurl string, times int) *Responser {
+	return r.add(NewMocker(responder, rawurl, times))
+}
+
+// NewInScenario registers a mocker to *Responser with rawurl's path, which only matches when scenario is in whenState.
+// NOTE: it may overwrite existed mocker with the same request path and the same state of scenario,
+// other mockers of the same request path are kept as alternatives.
+func (r *Responser) NewInScenario(responder http.RoundTripper, rawurl string, times int, scenario *Scenario, whenState, thenState string) *Responser {
+	mocker := NewMocker(responder, rawurl, times)
+	mocker.SetScenario(scenario, whenState, thenState)
+
+	return r.add(mocker)
+}
+
+// add registers mocker with its path, and keeps mockers of the same path in other states as alternatives.
+func (r *Responser) add(mocker *Mocker) *Responser {
 	r.mux.Lock()
 	defer r.mux.Unlock()
 
+	urlobj, _ := url.Parse(mocker.rawurl)
+
+	urlpath := urlobj.Path
+	if urlpath == "" {
+		urlpath = "/"
+	}
+
+	tail := mocker
+	for _, alt := range r.mocks[urlpath].Alternatives() {
+		if mocker.isSameState(alt) {
+			continue
+		}
+
+		tail.next = alt
+		tail = alt
+	}
+	tail.next = nil
+
+	r.mocks[urlpath] = mocker
+
+	return r
+}
+
+// Remove removes mocker with rawurl's path, it returns false if not exists.
+func (r *Responser) Remove(rawurl string) bool {
 	urlobj, err := url.Parse(rawurl)
 	if err != nil {
-		panic(err.Error())
+		return false
 	}
 
 	urlpath := urlobj.Path
@@ -44,16 +84,16 @@ func (r *Responser) New(responder http.RoundTripper, rawurl string, times int) *
 		urlpath = "/"
 	}
 
-	r.mocks[urlpath] = &Mocker{
-		responder:     responder,
-		matcher:       DefaultMatcher,
-		rawurl:        rawurl,
-		originScheme:  urlobj.Scheme,
-		expectedTimes: times,
-		invokedTimes:  0,
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if _, ok := r.mocks[urlpath]; !ok {
+		return false
 	}
 
-	return r
+	delete(r.mocks, urlpath)
+
+	return true
 }
 
 // Mocks returns all mockers of the *Responser
@@ -84,8 +124,9 @@ func (r *Responser) SetExpectedTimesByRawURL(rawurl string, expected int) {
 // Find resolves mocker related with the path, it's using following steps:
 //
 //	1, try path, e.g. /user
-//	2, try /, known as root path
-//	3, try wildcard, e.g. *
+//	2, try path pattern, e.g. /user/{id}
+//	3, try /, known as root path
+//	4, try wildcard, e.g. *
 //
 // NOTE: It returns mocker of the root path default if exists
 func (r *Responser) Find(urlpath string) *Mocker {
@@ -98,13 +139,36 @@ func (r *Responser) Find(urlpath string) *Mocker {
 		return mocker
 	}
 
-	// second, try root path
+	// second, try path pattern with the least named params
+	var (
+		pattern string
+		params  = -1
+	)
+	for key, alt := range r.mocks {
+		if !IsPathPattern(key) {
+			continue
+		}
+
+		values, ok := MatchPathPattern(key, urlpath)
+		if !ok {
+			continue
+		}
+
+		if params < 0 || len(values) < params || (len(values) == params && key < pattern) {
+			pattern, params, mocker = key, len(values), alt
+		}
+	}
+	if mocker != nil {
+		return mocker
+	}
+
+	// third, try root path
 	mocker, ok = r.mocks["/"]
 	if ok {
 		return mocker
 	}
 
-	// third, try wildcard
+	// fourth, try wildcard
 	return r.mocks[MockWildcard]
 }
 
@@ -119,3 +119,19 @@ func Test_TimeoutResponser(t *testing.T) {
 	it.EqualError(err, ErrTimeout.Error())
 	it.Nil(response)
 }
+
+func Test_ResponserFindWithPathPattern(t *testing.T) {
+	it := assert.New(t)
+	responder := new(testResponserRounderTrip)
+	responser := NewResponser(responder, mockURL+"/user/{id}", 1)
+	responser.New(responder, mockURL+"/user/{id}/posts/{post}", 1)
+	responser.New(responder, mockURL+"/user/me", 1)
+
+	// exist path has priority
+	it.Equal(responser.mocks["/user/me"], responser.Find("/user/me"))
+
+	// path pattern
+	it.Equal(responser.mocks["/user/{id}"], responser.Find("/user/1"))
+	it.Equal(responser.mocks["/user/{id}/posts/{post}"], responser.Find("/user/1/posts/2"))
+	it.Nil(responser.Find("/user/1/posts"))
+}
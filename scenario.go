@@ -0,0 +1,172 @@
+package httpmitm
+
+import (
+	"sort"
+	"sync"
+)
+
+const (
+	ScenarioStarted = "Started"
+	ScenarioDefault = "default"
+)
+
+// Scenario defines a named state machine shared by mocks of MitmTransport
+type Scenario struct {
+	mux sync.RWMutex
+
+	name  string
+	state string
+}
+
+// NewScenario creates *Scenario in ScenarioStarted state
+func NewScenario(name string) *Scenario {
+	return &Scenario{
+		name:  name,
+		state: ScenarioStarted,
+	}
+}
+
+// Name returns name of the scenario
+func (s *Scenario) Name() string {
+	return s.name
+}
+
+// State returns current state of the scenario
+func (s *Scenario) State() string {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return s.state
+}
+
+// SetState transits the scenario to state
+func (s *Scenario) SetState(state string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.state = state
+}
+
+// Reset transits the scenario to ScenarioStarted state
+func (s *Scenario) Reset() {
+	s.SetState(ScenarioStarted)
+}
+
+// Scenario returns scenario of name, a new one is created if not exists
+func (mitm *MitmTransport) Scenario(name string) *Scenario {
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	return mitm.lookupScenario(name)
+}
+
+// Scenarios returns all scenarios sorted by name
+func (mitm *MitmTransport) Scenarios() []*Scenario {
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	scenarios := make([]*Scenario, 0, len(mitm.scenarios))
+	for _, scenario := range mitm.scenarios {
+		scenarios = append(scenarios, scenario)
+	}
+
+	sort.Slice(scenarios, func(i, j int) bool {
+		return scenarios[i].name < scenarios[j].name
+	})
+
+	return scenarios
+}
+
+// ResetScenarios transits all scenarios to ScenarioStarted state
+func (mitm *MitmTransport) ResetScenarios() {
+	for _, scenario := range mitm.Scenarios() {
+		scenario.Reset()
+	}
+}
+
+// InScenario apply named scenario for current stub
+func (mitm *MitmTransport) InScenario(name string) *MitmTransport {
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	mitm.ensureChained()
+
+	mitm.lastMockedScenario = name
+
+	if mocker := mitm.lastMocker(); mocker != nil {
+		_, whenState, thenState := mocker.Scenario()
+
+		mocker.SetScenario(mitm.lookupScenario(name), whenState, thenState)
+	}
+
+	return mitm
+}
+
+// WhenState apply required state of scenario for current stub, the default scenario is used if none applied.
+// NOTE: It must be invoked before WithResponser(responder).
+func (mitm *MitmTransport) WhenState(state string) *MitmTransport {
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	mitm.ensureChained()
+
+	if mitm.mocked.Load() {
+		panic(ErrScenario.Error())
+	}
+
+	mitm.lastMockedWhenState = state
+
+	return mitm
+}
+
+// ThenState apply state of scenario transited to after current stub mocked, the default scenario is used if none applied.
+func (mitm *MitmTransport) ThenState(state string) *MitmTransport {
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	mitm.ensureChained()
+
+	mitm.lastMockedThenState = state
+
+	if mocker := mitm.lastMocker(); mocker != nil {
+		scenario, whenState, _ := mocker.Scenario()
+		if scenario == nil {
+			scenario = mitm.lookupScenario(ScenarioDefault)
+		}
+
+		mocker.SetScenario(scenario, whenState, state)
+	}
+
+	return mitm
+}
+
+// lastMocker returns mocker of current stub if it has responded
+func (mitm *MitmTransport) lastMocker() *Mocker {
+	if !mitm.mocked.Load() {
+		return nil
+	}
+
+	key, _ := mitm.calcRequestKey(mitm.lastMockedMethod, mitm.lastMockedURL)
+
+	responser, ok := mitm.stubs[key]
+	if !ok {
+		return nil
+	}
+
+	return responser.FindByRawURL(mitm.lastMockedURL)
+}
+
+func (mitm *MitmTransport) lookupScenario(name string) *Scenario {
+	if name == "" {
+		name = ScenarioDefault
+	}
+
+	scenario, ok := mitm.scenarios[name]
+	if !ok {
+		scenario = NewScenario(name)
+
+		mitm.scenarios[name] = scenario
+	}
+
+	return scenario
+}
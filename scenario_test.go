@@ -0,0 +1,75 @@
+package httpmitm
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_NewScenario(t *testing.T) {
+	it := assert.New(t)
+
+	scenario := NewScenario("job")
+	it.Equal("job", scenario.Name())
+	it.Equal(ScenarioStarted, scenario.State())
+
+	scenario.SetState("approved")
+	it.Equal("approved", scenario.State())
+
+	scenario.Reset()
+	it.Equal(ScenarioStarted, scenario.State())
+}
+
+func Test_MitmTransportWithScenario(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	// mocks
+	mt.MockRequest("GET", "https://example.com/job/1").WithResponse(200, nil, "pending").AnyTimes()
+	mt.MockRequest("POST", "https://example.com/job/1/approve").InScenario("job").ThenState("approved").WithResponse(204, nil, "")
+	mt.MockRequest("GET", "https://example.com/job/1").InScenario("job").WhenState("approved").WithResponse(200, nil, "approved").ThenState("done")
+	mt.MockRequest("GET", "https://example.com/job/1").InScenario("job").WhenState("done").WithResponse(200, nil, "done").AnyTimes()
+
+	get := func() string {
+		response, err := http.Get("mitm://example.com/job/1")
+		it.Nil(err)
+
+		b, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+
+		return string(b)
+	}
+
+	it.Equal("pending", get())
+	it.Equal("pending", get())
+	it.Equal(ScenarioStarted, mt.Scenario("job").State())
+
+	response, err := http.Post("mitm://example.com/job/1/approve", "text/plain", nil)
+	it.Nil(err)
+	it.Equal(204, response.StatusCode)
+	it.Equal("approved", mt.Scenario("job").State())
+
+	it.Equal("approved", get())
+	it.Equal("done", mt.Scenario("job").State())
+	it.Equal("done", get())
+
+	// reset
+	mt.ResetScenarios()
+	it.Equal(ScenarioStarted, mt.Scenario("job").State())
+	it.Equal("pending", get())
+}
+
+func Test_MitmTransportWhenStateAfterResponse(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	it.Panics(func() {
+		mt.MockRequest("GET", "https://example.com/job/1").WithResponse(200, nil, "pending").WhenState("approved")
+	})
+}
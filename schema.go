@@ -0,0 +1,397 @@
+package httpmitm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchemaViolation describes a value violates JSON Schema
+type SchemaViolation struct {
+	Pointer string // JSON pointer of the value, e.g. /body/items/0/name
+	Message string
+}
+
+func (v *SchemaViolation) String() string {
+	return v.Pointer + ": " + v.Message
+}
+
+// Schema validates values with a subset of JSON Schema used by OpenAPI 3, which supports
+// type, nullable, enum, const, required, properties, additionalProperties, items, min/maxItems, uniqueItems,
+// min/maxLength, pattern, format, min/maximum, exclusiveMin/Maximum, multipleOf, allOf, anyOf, oneOf and not.
+type Schema struct {
+	root    interface{}
+	resolve func(node interface{}) interface{}
+}
+
+// NewSchema creates *Schema from JSON string, []byte or decoded value, e.g. map[string]interface{}.
+// NOTE: local $ref is resolved against the schema itself, e.g. #/definitions/Pet
+func NewSchema(v interface{}) (*Schema, error) {
+	var root interface{}
+
+	switch t := v.(type) {
+	case string:
+		if err := json.Unmarshal([]byte(t), &root); err != nil {
+			return nil, err
+		}
+
+	case []byte:
+		if err := json.Unmarshal(t, &root); err != nil {
+			return nil, err
+		}
+
+	default:
+		// normalize with json for typed value, e.g. struct
+		data, err := json.Marshal(t)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(data, &root); err != nil {
+			return nil, err
+		}
+	}
+
+	doc := &OpenAPI{}
+	doc.doc, _ = root.(map[string]interface{})
+
+	return &Schema{
+		root:    root,
+		resolve: doc.resolve,
+	}, nil
+}
+
+// Validate returns violations of value with JSON pointers prefixed by pointer
+func (s *Schema) Validate(pointer string, value interface{}) []*SchemaViolation {
+	return s.validate(s.root, pointer, value)
+}
+
+// ValidateJSON decodes data and returns its violations with JSON pointers prefixed by pointer
+func (s *Schema) ValidateJSON(pointer string, data []byte) []*SchemaViolation {
+	value, err := decodeJSON(data)
+	if err != nil {
+		return []*SchemaViolation{
+			{Pointer: pointer, Message: "invalid JSON: " + err.Error()},
+		}
+	}
+
+	return s.Validate(pointer, value)
+}
+
+func (s *Schema) validate(node interface{}, pointer string, value interface{}) (violations []*SchemaViolation) {
+	schema, _ := s.resolve(node).(map[string]interface{})
+	if schema == nil {
+		return nil
+	}
+
+	report := func(format string, args ...interface{}) {
+		violations = append(violations, &SchemaViolation{
+			Pointer: pointer,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable || schemaAllowsNull(schema) {
+			return nil
+		}
+	}
+
+	if expected := schemaType(schema); expected != "" && !isSchemaType(expected, value) {
+		report("expected %s, but got %s", expected, jsonTypeOf(value))
+
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		matched := false
+		for _, item := range enum {
+			if jsonEqual(item, value) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			report("expected one of %v, but got %v", enum, value)
+		}
+	}
+
+	if constant, ok := schema["const"]; ok && !jsonEqual(constant, value) {
+		report("expected %v, but got %v", constant, value)
+	}
+
+	switch t := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := t[fmt.Sprint(name)]; !ok {
+				violations = append(violations, &SchemaViolation{
+					Pointer: pointer + "/" + escapePointer(fmt.Sprint(name)),
+					Message: "required property is missing",
+				})
+			}
+		}
+
+		names := make([]string, 0, len(t))
+		for name := range t {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			child := pointer + "/" + escapePointer(name)
+
+			if property, ok := properties[name]; ok {
+				violations = append(violations, s.validate(property, child, t[name])...)
+				continue
+			}
+
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					violations = append(violations, &SchemaViolation{
+						Pointer: child,
+						Message: "additional property is not allowed",
+					})
+				}
+
+			case map[string]interface{}:
+				violations = append(violations, s.validate(additional, child, t[name])...)
+			}
+		}
+
+	case []interface{}:
+		if minItems, ok := toFloat(schema["minItems"]); ok && float64(len(t)) < minItems {
+			report("expected at least %v items, but got %d", minItems, len(t))
+		}
+		if maxItems, ok := toFloat(schema["maxItems"]); ok && float64(len(t)) > maxItems {
+			report("expected at most %v items, but got %d", maxItems, len(t))
+		}
+		if unique, _ := schema["uniqueItems"].(bool); unique {
+			for i := range t {
+				for j := i + 1; j < len(t); j++ {
+					if jsonEqual(t[i], t[j]) {
+						report("expected unique items, but items %d and %d are equal", i, j)
+					}
+				}
+			}
+		}
+
+		if items, ok := schema["items"]; ok {
+			for i, item := range t {
+				violations = append(violations, s.validate(items, pointer+"/"+strconv.Itoa(i), item)...)
+			}
+		}
+
+	case string:
+		length := float64(len([]rune(t)))
+		if minLength, ok := toFloat(schema["minLength"]); ok && length < minLength {
+			report("expected at least %v characters, but got %v", minLength, length)
+		}
+		if maxLength, ok := toFloat(schema["maxLength"]); ok && length > maxLength {
+			report("expected at most %v characters, but got %v", maxLength, length)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(t) {
+				report("expected to match pattern %q, but got %q", pattern, t)
+			}
+		}
+		if format, ok := schema["format"].(string); ok && !isSchemaFormat(format, t) {
+			report("expected %s format, but got %q", format, t)
+		}
+
+	default:
+		if n, ok := toNumber(value); ok {
+			if minimum, ok := toFloat(schema["minimum"]); ok {
+				if exclusive, _ := schema["exclusiveMinimum"].(bool); (exclusive && n <= minimum) || n < minimum {
+					report("expected minimum of %v, but got %v", minimum, n)
+				}
+			}
+			if minimum, ok := toFloat(schema["exclusiveMinimum"]); ok && n <= minimum {
+				report("expected exclusive minimum of %v, but got %v", minimum, n)
+			}
+			if maximum, ok := toFloat(schema["maximum"]); ok {
+				if exclusive, _ := schema["exclusiveMaximum"].(bool); (exclusive && n >= maximum) || n > maximum {
+					report("expected maximum of %v, but got %v", maximum, n)
+				}
+			}
+			if maximum, ok := toFloat(schema["exclusiveMaximum"]); ok && n >= maximum {
+				report("expected exclusive maximum of %v, but got %v", maximum, n)
+			}
+			if multiple, ok := toFloat(schema["multipleOf"]); ok && multiple > 0 {
+				if q := n / multiple; math.Abs(q-math.Round(q)) > 1e-9 {
+					report("expected multiple of %v, but got %v", multiple, n)
+				}
+			}
+		}
+	}
+
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range allOf {
+			violations = append(violations, s.validate(sub, pointer, value)...)
+		}
+	}
+
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if len(s.validate(sub, pointer, value)) == 0 {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			report("expected to match any of %d schemas", len(anyOf))
+		}
+	}
+
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		matched := 0
+		for _, sub := range oneOf {
+			if len(s.validate(sub, pointer, value)) == 0 {
+				matched++
+			}
+		}
+
+		if matched != 1 {
+			report("expected to match exactly one of %d schemas, but matched %d", len(oneOf), matched)
+		}
+	}
+
+	if not, ok := schema["not"]; ok && len(s.validate(not, pointer, value)) == 0 {
+		report("expected not to match schema")
+	}
+
+	return
+}
+
+func decodeJSON(data []byte) (value interface{}, err error) {
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+
+	err = decoder.Decode(&value)
+	return
+}
+
+func schemaAllowsNull(schema map[string]interface{}) bool {
+	types, _ := schema["type"].([]interface{})
+	for _, item := range types {
+		if item == "null" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isSchemaType(expected string, value interface{}) bool {
+	switch expected {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+
+	case "string":
+		_, ok := value.(string)
+		return ok
+
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+
+	case "integer":
+		n, ok := toNumber(value)
+		return ok && n == math.Trunc(n)
+
+	case "number":
+		_, ok := toNumber(value)
+		return ok
+
+	case "null":
+		return value == nil
+	}
+
+	return true
+}
+
+func isSchemaFormat(format, value string) bool {
+	var err error
+
+	switch format {
+	case "date-time":
+		_, err = time.Parse(time.RFC3339, value)
+
+	case "date":
+		_, err = time.Parse("2006-01-02", value)
+
+	case "email":
+		_, err = mail.ParseAddress(value)
+
+	case "uuid":
+		return regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`).MatchString(value)
+	}
+
+	return err == nil
+}
+
+func jsonTypeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	}
+
+	if n, ok := toNumber(value); ok {
+		if n == math.Trunc(n) {
+			return "integer"
+		}
+
+		return "number"
+	}
+
+	return fmt.Sprintf("%T", value)
+}
+
+func jsonEqual(a, b interface{}) bool {
+	na, oka := toNumber(a)
+	nb, okb := toNumber(b)
+	if oka && okb {
+		return na == nb
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	if n, ok := v.(json.Number); ok {
+		f, err := n.Float64()
+		return f, err == nil
+	}
+
+	return toFloat(v)
+}
+
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
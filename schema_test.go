@@ -0,0 +1,55 @@
+package httpmitm
+
+import (
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_NewSchema(t *testing.T) {
+	it := assert.New(t)
+
+	schema, err := NewSchema(`{
+		"type": "object",
+		"required": ["name", "tags"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"age": {"type": "integer", "minimum": 0},
+			"email": {"type": "string", "format": "email"},
+			"tags": {"type": "array", "items": {"$ref": "#/definitions/tag"}}
+		},
+		"definitions": {
+			"tag": {"type": "string", "enum": ["a", "b"]}
+		}
+	}`)
+	it.Nil(err)
+
+	violations := schema.ValidateJSON("/body", []byte(`{"name":"x","age":1,"email":"x@example.com","tags":["a"]}`))
+	it.Empty(violations)
+
+	violations = schema.ValidateJSON("/body", []byte(`{"name":"","age":1.5,"email":"invalid","tags":["c"],"extra":true}`))
+	it.Equal([]string{
+		"/body/age: expected integer, but got number",
+		"/body/email: expected email format, but got \"invalid\"",
+		"/body/extra: additional property is not allowed",
+		"/body/name: expected at least 1 characters, but got 0",
+		"/body/tags/0: expected one of [a b], but got c",
+	}, violationStrings(violations))
+
+	violations = schema.ValidateJSON("/body", []byte(`{"name":"x"}`))
+	it.Equal([]string{"/body/tags: required property is missing"}, violationStrings(violations))
+
+	violations = schema.ValidateJSON("/body", []byte(`invalid`))
+	it.Equal(1, len(violations))
+	it.Equal("/body", violations[0].Pointer)
+}
+
+func violationStrings(violations []*SchemaViolation) []string {
+	lines := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		lines = append(lines, violation.String())
+	}
+
+	return lines
+}
@@ -0,0 +1,415 @@
+package httpmitm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// MitmHandler implements http.Handler, which serves real http requests with stubs of MitmTransport.
+// The virtual host of request is resolved with Host header, it falls back to the default host if not mocked.
+type MitmHandler struct {
+	mux sync.RWMutex
+
+	mitm        *MitmTransport
+	defaultHost string
+	passthrough http.RoundTripper // for unmatched requests, nil for responding with error
+	proxied     bool              // whether serving requests of proxy, which keeps origin url of redirects
+}
+
+// Handler returns *MitmHandler of stubs, which dispatches requests through the same matchers,
+// responders and expectation counting as RoundTrip.
+func (mitm *MitmTransport) Handler() *MitmHandler {
+	return &MitmHandler{
+		mitm: mitm,
+	}
+}
+
+// WithDefaultHost sets virtual host for requests whose Host header is not mocked, e.g. 127.0.0.1:port of listener.
+// NOTE: The only mocked host is used if no default host given.
+func (h *MitmHandler) WithDefaultHost(host string) *MitmHandler {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	h.defaultHost = host
+
+	return h
+}
+
+// WithPassthrough sets http.RoundTripper for unmatched requests, which are sent to origin of the virtual host,
+// e.g. a recorder of unseen traffic. Unmatched requests are responded with error if nil.
+func (h *MitmHandler) WithPassthrough(rt http.RoundTripper) *MitmHandler {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	h.passthrough = rt
+
+	return h
+}
+
+// ServeHTTP implements http.Handler
+func (h *MitmHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := h.resolveHost(r.Host)
+
+	if h.passthroughTransport() != nil && (host == "" || h.matchedHost(r, host) == "") {
+		if host == "" {
+			host = r.Host
+		}
+
+		scheme := h.mitm.originURL(&url.URL{Scheme: MockScheme, Host: host, Path: r.URL.Path}).Scheme
+
+		h.forward(w, r, scheme, host)
+		return
+	}
+
+	if host == "" {
+		http.Error(w, ErrRefused.Error(), http.StatusBadGateway)
+		return
+	}
+
+	h.serve(w, r, host)
+}
+
+// serve dispatches r to stubs of the virtual host
+func (h *MitmHandler) serve(w http.ResponseWriter, r *http.Request, host string) {
+	urlobj := *r.URL
+	urlobj.Scheme = MockScheme
+	urlobj.Host = host
+
+	req := r.Clone(r.Context())
+	req.URL = &urlobj
+	req.Host = host
+	req.RequestURI = ""
+
+	resp, err := h.mitm.RoundTrip(req)
+	if err != nil {
+		var contractErr *ContractError
+
+		switch {
+		case errors.Is(err, ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+
+		case errors.Is(err, ErrTimeout):
+			http.Error(w, err.Error(), http.StatusGatewayTimeout)
+
+		case errors.As(err, &contractErr):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+
+		default:
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		}
+
+		return
+	}
+
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		h.serveUpgrade(w, resp)
+		return
+	}
+
+	h.serveResponse(w, r, host, resp)
+}
+
+// forward sends r to origin of host with passthrough transport
+func (h *MitmHandler) forward(w http.ResponseWriter, r *http.Request, scheme, host string) {
+	urlobj := *r.URL
+	urlobj.Scheme = scheme
+	urlobj.Host = host
+
+	req := r.Clone(r.Context())
+	req.URL = &urlobj
+	req.Host = host
+	req.RequestURI = ""
+
+	passthrough := h.passthroughTransport()
+	if passthrough == nil {
+		http.Error(w, ErrRefused.Error(), http.StatusBadGateway)
+		return
+	}
+
+	h.mitm.observer().passthrough(req, PassthroughUnmocked)
+
+	resp, err := passthrough.RoundTrip(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	removeHopHeaders(resp.Header)
+
+	h.serveResponse(w, r, host, resp)
+}
+
+// serveResponse writes resp back to w, the body is flushed as it's read for streaming responses.
+func (h *MitmHandler) serveResponse(w http.ResponseWriter, r *http.Request, host string, resp *http.Response) {
+	if resp.Body != nil {
+		defer resp.Body.Close()
+	}
+
+	header := w.Header()
+	for key, values := range resp.Header {
+		header[key] = values
+	}
+	header.Del("Transfer-Encoding")
+
+	if resp.ContentLength < 0 || resp.Uncompressed {
+		header.Del("Content-Length")
+	}
+
+	for key := range resp.Trailer {
+		header.Add("Trailer", key)
+	}
+
+	// redirect within mocked hosts of the server, or to origin url for proxy
+	if location := header.Get("Location"); strings.HasPrefix(location, MockScheme+"://") {
+		if urlobj, err := url.Parse(location); err == nil {
+			if h.proxied {
+				urlobj = h.mitm.originURL(urlobj)
+			} else {
+				urlobj.Scheme = "http"
+				if strings.EqualFold(urlobj.Host, host) {
+					urlobj.Host = r.Host
+				}
+			}
+
+			header.Set("Location", urlobj.String())
+		}
+	}
+
+	w.WriteHeader(resp.StatusCode)
+
+	if resp.Body != nil && r.Method != http.MethodHead {
+		flusher, _ := w.(http.Flusher)
+
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := resp.Body.Read(buf)
+			if n > 0 {
+				if _, werr := w.Write(buf[:n]); werr != nil {
+					return
+				}
+
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	for key, values := range resp.Trailer {
+		header[key] = values
+	}
+}
+
+// serveUpgrade hijacks connection of w for upgraded response, e.g. WebSocket, and pipes it with resp.Body.
+func (h *MitmHandler) serveUpgrade(w http.ResponseWriter, resp *http.Response) {
+	body, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		http.Error(w, ErrUnsupported.Error(), http.StatusBadGateway)
+		return
+	}
+	defer body.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, ErrUnsupported.Error(), http.StatusBadGateway)
+		return
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(rw, "HTTP/1.1 %d %s\r\n", resp.StatusCode, http.StatusText(resp.StatusCode))
+	resp.Header.Write(rw)
+	rw.WriteString("\r\n")
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	done := make(chan struct{}, 2)
+
+	go func() {
+		io.Copy(body, bufferedConn{conn, rw.Reader})
+		body.Close()
+
+		done <- struct{}{}
+	}()
+
+	go func() {
+		io.Copy(conn, body)
+		conn.Close()
+
+		done <- struct{}{}
+	}()
+
+	<-done
+	<-done
+}
+
+// resolveHost returns mocked host of Host header, the default host or the only mocked host.
+func (h *MitmHandler) resolveHost(host string) string {
+	h.mux.RLock()
+	defaultHost := h.defaultHost
+	h.mux.RUnlock()
+
+	mitm := h.mitm
+
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	if host != "" {
+		if mitm.isHostMocked(host) {
+			return host
+		}
+
+		// try without port, e.g. api.example.com:80
+		if hostname, _, err := net.SplitHostPort(host); err == nil && mitm.isHostMocked(hostname) {
+			return hostname
+		}
+	}
+
+	if defaultHost != "" {
+		return defaultHost
+	}
+
+	hosts := map[string]bool{}
+	for key := range mitm.stubs {
+		_, rawurl, _ := strings.Cut(key, " ")
+
+		if urlobj, err := url.Parse(rawurl); err == nil {
+			hosts[urlobj.Host] = true
+		}
+	}
+
+	if len(hosts) == 1 {
+		for host := range hosts {
+			return host
+		}
+	}
+
+	return ""
+}
+
+// matchedHost returns key host of stubs which mocks the request, it's empty if not mocked.
+func (h *MitmHandler) matchedHost(r *http.Request, host string) string {
+	mitm := h.mitm
+
+	for _, candidate := range hostCandidates(host) {
+		mitm.mux.Lock()
+		responser, ok := mitm.stubs[mitm.normalizeKey(r.Method, MockScheme, candidate)]
+		mitm.mux.Unlock()
+		if !ok {
+			continue
+		}
+
+		mocker := responser.Find(r.URL.Path)
+		if mocker == nil {
+			continue
+		}
+
+		target := mocker.resolve()
+		if target == nil {
+			continue
+		}
+
+		urlobj := *r.URL
+		urlobj.Scheme = MockScheme
+		urlobj.Host = candidate
+
+		probe := r.Clone(r.Context())
+		probe.URL = &urlobj
+
+		target.mux.RLock()
+		matched := target.IsRequestMatched(probe)
+		target.mux.RUnlock()
+
+		// NOTE: body may be consumed and restored by matcher
+		r.Body = probe.Body
+
+		if matched {
+			return candidate
+		}
+	}
+
+	return ""
+}
+
+func (h *MitmHandler) passthroughTransport() http.RoundTripper {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+
+	return h.passthrough
+}
+
+// hostCandidates returns host and its hostname without port
+func hostCandidates(host string) []string {
+	candidates := []string{host}
+
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		candidates = append(candidates, hostname)
+	}
+
+	return candidates
+}
+
+// bufferedConn reads from buffered reader of hijacked connection first
+type bufferedConn struct {
+	net.Conn
+
+	reader *bufio.Reader
+}
+
+func (c bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// MitmServer is a real http server backed by stubs of MitmTransport, it's useful for code under test
+// which is not using http.Client of Go, e.g. a subprocess or a browser.
+type MitmServer struct {
+	*httptest.Server
+
+	handler *MitmHandler
+}
+
+// Server starts *MitmServer listening on a loopback address, the caller should call Close when finished.
+//
+//	srv := mt.Server().WithDefaultHost("api.example.com")
+//	defer srv.Close()
+//
+//	cmd := exec.Command("curl", srv.URL+"/users")
+//
+// NOTE: Multiple virtual hosts are routed by Host header, e.g. curl -H "Host: api.example.com" $URL.
+func (mitm *MitmTransport) Server() *MitmServer {
+	handler := mitm.Handler()
+
+	return &MitmServer{
+		Server:  httptest.NewServer(handler),
+		handler: handler,
+	}
+}
+
+// WithDefaultHost sets virtual host for requests whose Host header is not mocked
+func (srv *MitmServer) WithDefaultHost(host string) *MitmServer {
+	srv.handler.WithDefaultHost(host)
+
+	return srv
+}
+
+// Handler returns *MitmHandler of the server
+func (srv *MitmServer) Handler() *MitmHandler {
+	return srv.handler
+}
@@ -0,0 +1,187 @@
+package httpmitm
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_MitmTransportServer(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/users/{id}").WithJsonResponse(200, nil, map[string]string{"name": "mitm"}).Times(2)
+	mt.MockRequest("GET", "https://www.example.com").WithResponse(200, nil, "Hello, httpmitm!")
+	mt.MockRequest("GET", "https://www.example.com/old").WithRedirectResponse(302, "https://www.example.com")
+
+	srv := mt.Server().WithDefaultHost("api.example.com")
+	defer srv.Close()
+
+	client := &http.Client{
+		Transport: &http.Transport{},
+	}
+
+	// default host
+	response, err := client.Get(srv.URL + "/users/1")
+	if it.Nil(err) {
+		it.Equal(200, response.StatusCode)
+		it.Equal("application/json", response.Header.Get("Content-Type"))
+
+		b, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		it.Equal(`{"name":"mitm"}`, string(b))
+	}
+
+	// virtual host with port
+	request, _ := http.NewRequest("GET", srv.URL+"/users/2", nil)
+	request.Host = "api.example.com:443"
+
+	response, err = client.Do(request)
+	if it.Nil(err) {
+		it.Equal(200, response.StatusCode)
+		response.Body.Close()
+	}
+
+	// redirect within virtual host
+	request, _ = http.NewRequest("GET", srv.URL+"/old", nil)
+	request.Host = "www.example.com"
+
+	response, err = (&http.Client{
+		Transport: &http.Transport{},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}).Do(request)
+	if it.Nil(err) {
+		it.Equal(302, response.StatusCode)
+		it.Equal("http://www.example.com", response.Header.Get("Location"))
+		response.Body.Close()
+	}
+
+	request, _ = http.NewRequest("GET", srv.URL, nil)
+	request.Host = "www.example.com"
+
+	response, err = client.Do(request)
+	if it.Nil(err) {
+		b, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		it.Equal("Hello, httpmitm!", string(b))
+	}
+
+	// not found
+	response, err = client.Get(srv.URL + "/unknown/path")
+	if it.Nil(err) {
+		it.Equal(404, response.StatusCode)
+		response.Body.Close()
+	}
+}
+
+func Test_MitmTransportServerWithoutDefaultHost(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/stream").WithChunkedResponse(200, nil, 0, []byte("Hello, "), []byte("httpmitm!"))
+
+	srv := mt.Server()
+	defer srv.Close()
+
+	client := &http.Client{
+		Transport: &http.Transport{},
+	}
+
+	// the only mocked host
+	response, err := client.Get(srv.URL + "/stream")
+	if it.Nil(err) {
+		it.Equal([]string{"chunked"}, response.TransferEncoding)
+
+		b, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		it.Equal("Hello, httpmitm!", string(b))
+	}
+
+	// refused for multiple hosts
+	mt.MockRequest("GET", "https://www.example.com").WithResponse(200, nil, "").AnyTimes()
+
+	response, err = client.Get(srv.URL + "/stream")
+	if it.Nil(err) {
+		it.Equal(502, response.StatusCode)
+
+		b, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		it.True(strings.Contains(string(b), ErrRefused.Error()))
+	}
+}
+
+func Test_MitmTransportServerWithWebSocket(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://ws.example.com/chat").WithResponser(NewWebSocketScriptResponder(
+		WebSocketExpectText("ping"),
+		WebSocketSendText("pong"),
+		WebSocketCloseWith(1000, "bye"),
+	))
+
+	srv := mt.Server()
+	defer srv.Close()
+
+	request, _ := NewWebSocketRequest(srv.URL + "/chat")
+
+	response, err := (&http.Client{Transport: &http.Transport{}}).Do(request)
+	if it.Nil(err) {
+		it.Equal(101, response.StatusCode)
+
+		rwc, ok := response.Body.(io.ReadWriteCloser)
+		if it.True(ok) {
+			conn := NewWebSocketClient(rwc)
+			it.Nil(conn.WriteText("ping"))
+
+			text, err := conn.ReadText()
+			it.Nil(err)
+			it.Equal("pong", text)
+
+			conn.Close(1000, "")
+		}
+	}
+}
+
+func Test_MitmTransportServerWithPassthrough(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "http://api.example.com/users").WithResponse(200, nil, "users")
+
+	srv := mt.Server()
+	defer srv.Close()
+
+	var passed []string
+	srv.Handler().WithPassthrough(NewCalleeResponder(func(r *http.Request) (int, http.Header, io.Reader, error) {
+		passed = append(passed, r.URL.String())
+
+		return 200, nil, strings.NewReader("passed"), nil
+	}))
+
+	client := &http.Client{
+		Transport: &http.Transport{},
+	}
+
+	for _, path := range []string{"/users", "/unmatched"} {
+		response, err := client.Get(srv.URL + path)
+		if it.Nil(err) {
+			it.Equal(200, response.StatusCode)
+			response.Body.Close()
+		}
+	}
+	it.Equal([]string{"http://api.example.com/unmatched"}, passed)
+}
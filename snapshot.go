@@ -0,0 +1,304 @@
+package httpmitm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"text/tabwriter"
+)
+
+var (
+	funcLiteralRegexp = regexp.MustCompile(`(\.func\d+)+$`)
+)
+
+// StubSnapshot describes a registered mock at the time of snapshot
+type StubSnapshot struct {
+	Method    string `json:"method"`
+	URL       string `json:"url"`    // original url of the mock
+	Scheme    string `json:"scheme"` // original scheme of the mock, e.g. http or https
+	Matcher   string `json:"matcher"`
+	Expected  int    `json:"expected"` // -1 for unlimited times
+	Invoked   int    `json:"invoked"`
+	Responder string `json:"responder"`        // kind of responder, e.g. Responder or SequenceResponder
+	Status    int    `json:"status,omitempty"` // 0 for errors and dynamic responses
+	Scenario  string `json:"scenario,omitempty"`
+	WhenState string `json:"whenState,omitempty"`
+	ThenState string `json:"thenState,omitempty"`
+}
+
+// String returns description of the stub in a line
+func (stub *StubSnapshot) String() string {
+	expected := "any"
+	if stub.Expected >= 0 {
+		expected = strconv.Itoa(stub.Expected)
+	}
+
+	status := "-"
+	if stub.Status > 0 {
+		status = strconv.Itoa(stub.Status)
+	}
+
+	s := fmt.Sprintf("%s %s matcher=%s times=%d/%s responder=%s status=%s",
+		stub.Method, stub.URL, stub.Matcher, stub.Invoked, expected, stub.Responder, status)
+	if stub.Scenario != "" {
+		s += fmt.Sprintf(" scenario=%s(%s->%s)", stub.Scenario, stub.WhenState, stub.ThenState)
+	}
+
+	return s
+}
+
+// Snapshot describes all registered mocks of MitmTransport, see MitmTransport.Snapshot for details.
+type Snapshot struct {
+	Paused bool            `json:"paused"`
+	Stubs  []*StubSnapshot `json:"stubs"`
+}
+
+// String returns description of all stubs, one line for each
+func (snapshot *Snapshot) String() string {
+	var buf bytes.Buffer
+
+	for _, stub := range snapshot.Stubs {
+		buf.WriteString(stub.String())
+		buf.WriteByte('\n')
+	}
+
+	return buf.String()
+}
+
+// JSON returns indented JSON of the snapshot
+func (snapshot *Snapshot) JSON() ([]byte, error) {
+	stubs := snapshot.Stubs
+	if stubs == nil {
+		stubs = []*StubSnapshot{}
+	}
+
+	return json.MarshalIndent(&Snapshot{
+		Paused: snapshot.Paused,
+		Stubs:  stubs,
+	}, "", "  ")
+}
+
+// Table returns aligned table of all stubs with a header line
+func (snapshot *Snapshot) Table() string {
+	var buf bytes.Buffer
+
+	snapshot.WriteTable(&buf)
+
+	return buf.String()
+}
+
+// WriteTable writes aligned table of all stubs to w
+func (snapshot *Snapshot) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "METHOD\tURL\tMATCHER\tTIMES\tRESPONDER\tSTATUS\tSCENARIO")
+	for _, stub := range snapshot.Stubs {
+		expected := "any"
+		if stub.Expected >= 0 {
+			expected = strconv.Itoa(stub.Expected)
+		}
+
+		status := "-"
+		if stub.Status > 0 {
+			status = strconv.Itoa(stub.Status)
+		}
+
+		scenario := "-"
+		if stub.Scenario != "" {
+			scenario = fmt.Sprintf("%s(%s->%s)", stub.Scenario, stub.WhenState, stub.ThenState)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d/%s\t%s\t%s\t%s\n",
+			stub.Method, stub.URL, stub.Matcher, stub.Invoked, expected, stub.Responder, status, scenario)
+	}
+
+	return tw.Flush()
+}
+
+// Snapshot returns typed descriptions of all registered mocks sorted by url and method
+func (mitm *MitmTransport) Snapshot() *Snapshot {
+	snapshot := &Snapshot{
+		Paused: mitm.IsPaused(),
+	}
+
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	for key, responser := range mitm.stubs {
+		if responser == RefusedResponser {
+			continue
+		}
+
+		method, _, _ := strings.Cut(key, " ")
+
+		for _, mocker := range responser.Mocks() {
+			for _, alt := range mocker.Alternatives() {
+				snapshot.Stubs = append(snapshot.Stubs, newStubSnapshot(method, alt))
+			}
+		}
+	}
+
+	sort.SliceStable(snapshot.Stubs, func(i, j int) bool {
+		if snapshot.Stubs[i].URL != snapshot.Stubs[j].URL {
+			return snapshot.Stubs[i].URL < snapshot.Stubs[j].URL
+		}
+
+		return snapshot.Stubs[i].Method < snapshot.Stubs[j].Method
+	})
+
+	return snapshot
+}
+
+// Dump writes table of all registered mocks to w, see TestingWriter for routing to t.Log.
+func (mitm *MitmTransport) Dump(w io.Writer) error {
+	return mitm.Snapshot().WriteTable(w)
+}
+
+// TestingWriter returns io.Writer which logs each line written with t.Log, e.g.
+//
+//	mt.Dump(httpmitm.TestingWriter(t))
+func TestingWriter(t testing.TB) io.Writer {
+	return &testingWriter{t: t}
+}
+
+type testingWriter struct {
+	t testing.TB
+}
+
+func (w *testingWriter) Write(p []byte) (int, error) {
+	w.t.Helper()
+
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		w.t.Log(line)
+	}
+
+	return len(p), nil
+}
+
+func newStubSnapshot(method string, m *Mocker) *StubSnapshot {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+
+	stub := &StubSnapshot{
+		Method:    method,
+		URL:       m.rawurl,
+		Scheme:    m.originScheme,
+		Matcher:   describeMatcher(m.matcher),
+		Expected:  m.expectedTimes,
+		Invoked:   m.invokedTimes,
+		Responder: describeResponder(m.responder),
+		Status:    responderStatus(m.responder),
+	}
+	if stub.Expected == MockUnlimitedTimes {
+		stub.Expected = -1
+	}
+
+	if m.scenario != nil {
+		stub.Scenario = m.scenario.Name()
+		stub.WhenState = m.whenState
+		stub.ThenState = m.thenState
+	}
+
+	return stub
+}
+
+// describeMatcher returns short name of the function for matcher, e.g. MatchCookie
+func describeMatcher(matcher RequestMatcher) string {
+	if matcher == nil {
+		return "none"
+	}
+
+	pc := reflect.ValueOf(matcher).Pointer()
+	if pc == reflect.ValueOf(DefaultMatcher).Pointer() {
+		return "default"
+	}
+
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return "custom"
+	}
+
+	name := fn.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+
+	name = funcLiteralRegexp.ReplaceAllString(name, "")
+	if name == "" || strings.HasPrefix(name, "init") {
+		return "custom"
+	}
+
+	return name
+}
+
+// describeResponder returns kind of responder, e.g. Responder or DelayResponder
+func describeResponder(responder http.RoundTripper) string {
+	if responder == nil {
+		return "none"
+	}
+
+	rt := reflect.TypeOf(responder)
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+
+	if rt.Name() == "" {
+		return rt.String()
+	}
+
+	return rt.Name()
+}
+
+// responderStatus returns status code responded by responder, it returns 0 if unknown.
+func responderStatus(responder http.RoundTripper) int {
+	switch r := responder.(type) {
+	case *Responder:
+		if r.err != nil || r.callee != nil {
+			return 0
+		}
+
+		return r.code
+
+	case *StreamResponder:
+		return r.code
+
+	case *DelayResponder:
+		return responderStatus(r.responder)
+
+	case *EncodingResponder:
+		return responderStatus(r.responder)
+
+	case *CookieResponder:
+		return responderStatus(r.responder)
+
+	case *RateLimitResponder:
+		return responderStatus(r.responder)
+
+	case *SequenceResponder:
+		r.mux.Lock()
+		defer r.mux.Unlock()
+
+		if len(r.responders) == 0 {
+			return 0
+		}
+
+		return responderStatus(r.responders[r.index])
+
+	case *WebSocketResponder:
+		return http.StatusSwitchingProtocols
+	}
+
+	return 0
+}
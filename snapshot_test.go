@@ -0,0 +1,118 @@
+package httpmitm
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+)
+
+func Test_MitmTransportSnapshot(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, nil, "").AnyTimes()
+	mt.MockRequest("POST", "http://api.example.com/users").ByMatcher(MatchCookie("session", "xxx")).WithResponser(NewDelayResponder(NewJsonResponder(201, nil, ""), time.Millisecond)).Times(2)
+	mt.MockRequest("GET", "https://api.example.com/state").InScenario("login").WhenState(ScenarioStarted).ThenState("logged").WithResponser(NewSequenceResponder(NewResponder(202, nil, ""), NewTimeoutResponder()))
+
+	response, err := http.Get("mitm://api.example.com/users")
+	it.Nil(err)
+	response.Body.Close()
+
+	snapshot := mt.Snapshot()
+	it.False(snapshot.Paused)
+	if it.Equal(3, len(snapshot.Stubs)) {
+		it.Equal(&StubSnapshot{
+			Method:    "POST",
+			URL:       "http://api.example.com/users",
+			Scheme:    "http",
+			Matcher:   "MatchCookie",
+			Expected:  2,
+			Responder: "DelayResponder",
+			Status:    201,
+		}, snapshot.Stubs[0])
+		it.Equal(&StubSnapshot{
+			Method:    "GET",
+			URL:       "https://api.example.com/state",
+			Scheme:    "https",
+			Matcher:   "default",
+			Expected:  1,
+			Responder: "SequenceResponder",
+			Status:    202,
+			Scenario:  "login",
+			WhenState: ScenarioStarted,
+			ThenState: "logged",
+		}, snapshot.Stubs[1])
+		it.Equal(&StubSnapshot{
+			Method:    "GET",
+			URL:       "https://api.example.com/users",
+			Scheme:    "https",
+			Matcher:   "default",
+			Expected:  -1,
+			Invoked:   1,
+			Responder: "Responder",
+			Status:    200,
+		}, snapshot.Stubs[2])
+	}
+
+	it.Equal("GET https://api.example.com/users matcher=default times=1/any responder=Responder status=200", snapshot.Stubs[2].String())
+	it.Contains(snapshot.String(), "responder=SequenceResponder status=202 scenario=login(Started->logged)")
+
+	data, err := snapshot.JSON()
+	if it.Nil(err) {
+		var decoded Snapshot
+		it.Nil(json.Unmarshal(data, &decoded))
+		it.Equal(snapshot.Stubs, decoded.Stubs)
+	}
+
+	lines := strings.Split(strings.TrimSpace(snapshot.Table()), "\n")
+	if it.Equal(4, len(lines)) {
+		it.Equal([]string{"METHOD", "URL", "MATCHER", "TIMES", "RESPONDER", "STATUS", "SCENARIO"}, strings.Fields(lines[0]))
+		it.Equal([]string{"POST", "http://api.example.com/users", "MatchCookie", "0/2", "DelayResponder", "201", "-"}, strings.Fields(lines[1]))
+	}
+
+	mt.Pause()
+	it.True(mt.Snapshot().Paused)
+}
+
+func Test_MitmTransportSnapshotWithCustomMatcher(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/users").ByMatcher(func(r *http.Request, urlobj *url.URL) bool {
+		return true
+	}).WithResponser(NewCalleeResponder(func(r *http.Request) (int, http.Header, io.Reader, error) {
+		return 200, nil, strings.NewReader(""), nil
+	}))
+
+	stubs := mt.Snapshot().Stubs
+	if it.Equal(1, len(stubs)) {
+		it.Equal("Test_MitmTransportSnapshotWithCustomMatcher", stubs[0].Matcher)
+		it.Equal("Responder", stubs[0].Responder)
+		it.Equal(0, stubs[0].Status)
+	}
+}
+
+func Test_MitmTransportDump(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, nil, "")
+
+	var buf strings.Builder
+	it.Nil(mt.Dump(&buf))
+	it.Contains(buf.String(), "https://api.example.com/users")
+
+	it.Nil(mt.Dump(TestingWriter(t)))
+}
@@ -0,0 +1,74 @@
+package httpmitm
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SSEEvent defines an event of Server-Sent Events stream
+type SSEEvent struct {
+	ID    string
+	Event string
+	Data  string
+	Retry time.Duration // reconnection time, ignored if zero
+	Delay time.Duration // gap before sending the event
+}
+
+// String returns wire format of the event
+func (e SSEEvent) String() string {
+	var buf strings.Builder
+
+	if e.ID != "" {
+		buf.WriteString("id: " + e.ID + "\n")
+	}
+	if e.Event != "" {
+		buf.WriteString("event: " + e.Event + "\n")
+	}
+	if e.Retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+	}
+	for _, line := range strings.Split(e.Data, "\n") {
+		buf.WriteString("data: " + line + "\n")
+	}
+	buf.WriteString("\n")
+
+	return buf.String()
+}
+
+// NewSSEResponder returns StreamResponder which emits events in text/event-stream format.
+// NOTE: It skips events up to the one identified by Last-Event-ID header of reconnected request.
+func NewSSEResponder(events ...SSEEvent) http.RoundTripper {
+	header := http.Header{}
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+
+	return NewGeneratorResponder(http.StatusOK, header, func(r *http.Request, w io.Writer) error {
+		script := events
+
+		if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+			for i, event := range events {
+				if event.ID == lastID {
+					script = events[i+1:]
+					break
+				}
+			}
+		}
+
+		for _, event := range script {
+			if event.Delay > 0 {
+				if err := sleepWithRequest(r, event.Delay); err != nil {
+					return err
+				}
+			}
+
+			if _, err := io.WriteString(w, event.String()); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
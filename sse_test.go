@@ -0,0 +1,56 @@
+package httpmitm
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+)
+
+func Test_SSEEvent(t *testing.T) {
+	it := assert.New(t)
+
+	event := SSEEvent{
+		ID:    "1",
+		Event: "message",
+		Data:  "Hello,\nworld!",
+		Retry: 3 * time.Second,
+	}
+	it.Equal("id: 1\nevent: message\nretry: 3000\ndata: Hello,\ndata: world!\n\n", event.String())
+}
+
+func Test_NewSSEResponder(t *testing.T) {
+	it := assert.New(t)
+
+	responder := NewSSEResponder(
+		SSEEvent{ID: "1", Data: "first"},
+		SSEEvent{ID: "2", Data: "second", Delay: 5 * time.Millisecond},
+		SSEEvent{ID: "3", Data: "third"},
+	)
+	it.Implements((*http.RoundTripper)(nil), responder)
+
+	request, _ := http.NewRequest("GET", mockURL, nil)
+	response, err := responder.RoundTrip(request)
+	it.Nil(err)
+	it.Equal(200, response.StatusCode)
+	it.Equal("text/event-stream", response.Header.Get("Content-Type"))
+
+	b, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	it.Nil(err)
+	it.Equal("id: 1\ndata: first\n\nid: 2\ndata: second\n\nid: 3\ndata: third\n\n", string(b))
+
+	// reconnect with Last-Event-ID
+	request, _ = http.NewRequest("GET", mockURL, nil)
+	request.Header.Set("Last-Event-ID", "2")
+
+	response, err = responder.RoundTrip(request)
+	it.Nil(err)
+
+	b, err = io.ReadAll(response.Body)
+	response.Body.Close()
+	it.Nil(err)
+	it.Equal("id: 3\ndata: third\n\n", string(b))
+}
@@ -0,0 +1,234 @@
+package httpmitm
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// StreamResponder defines streaming response of mocked request.
+// NOTE: It responds with chunked transfer encoding when the size of body is unknown.
+type StreamResponder struct {
+	code      int
+	header    http.Header
+	length    int64 // -1 for chunked
+	generator func(r *http.Request, w io.Writer) error
+	reader    func(r *http.Request) io.Reader
+}
+
+// NewChunkedResponder returns StreamResponder which writes chunks one by one with delay between them
+func NewChunkedResponder(code int, header http.Header, delay time.Duration, chunks ...[]byte) http.RoundTripper {
+	return NewGeneratorResponder(code, header, func(r *http.Request, w io.Writer) error {
+		for i, chunk := range chunks {
+			if i > 0 && delay > 0 {
+				if err := sleepWithRequest(r, delay); err != nil {
+					return err
+				}
+			}
+
+			if _, err := w.Write(chunk); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// NewChannelResponder returns StreamResponder which writes chunks received from ch until it's closed
+func NewChannelResponder(code int, header http.Header, ch <-chan []byte) http.RoundTripper {
+	return NewGeneratorResponder(code, header, func(r *http.Request, w io.Writer) error {
+		for {
+			select {
+			case chunk, ok := <-ch:
+				if !ok {
+					return nil
+				}
+
+				if _, err := w.Write(chunk); err != nil {
+					return err
+				}
+
+			case <-r.Context().Done():
+				return r.Context().Err()
+			}
+		}
+	})
+}
+
+// NewGeneratorResponder returns StreamResponder which writes body by invoking generator with mocked request.
+// NOTE: generator is invoked within a new goroutine, and writes fail after response body closed.
+func NewGeneratorResponder(code int, header http.Header, generator func(r *http.Request, w io.Writer) error) http.RoundTripper {
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &StreamResponder{
+		code:      code,
+		header:    header,
+		length:    -1,
+		generator: generator,
+	}
+}
+
+// NewSyntheticResponder returns StreamResponder with size bytes of deterministic data without allocating them.
+// NOTE: the body is the same as NewSyntheticReader(size) returns.
+func NewSyntheticResponder(code int, header http.Header, size int64) http.RoundTripper {
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &StreamResponder{
+		code:   code,
+		header: header,
+		length: size,
+		reader: func(r *http.Request) io.Reader {
+			return NewSyntheticReader(size)
+		},
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (s *StreamResponder) RoundTrip(req *http.Request) (*http.Response, error) {
+	header := s.header.Clone()
+
+	response := &http.Response{
+		Status:        responseStatus(s.code),
+		StatusCode:    s.code,
+		Header:        header,
+		ContentLength: s.length,
+		Request:       req,
+	}
+
+	if s.length < 0 {
+		header.Del("Content-Length")
+
+		response.TransferEncoding = []string{"chunked"}
+	} else {
+		header.Set("Content-Length", strconv.FormatInt(s.length, 10))
+	}
+
+	if s.generator != nil {
+		response.Body = newStreamBody(req, s.generator)
+	} else {
+		response.Body = &contextBody{
+			Reader: s.reader(req),
+			req:    req,
+		}
+	}
+
+	return response, nil
+}
+
+// streamBody is a response body fed by generator within a goroutine.
+type streamBody struct {
+	*io.PipeReader
+
+	done chan struct{}
+}
+
+func newStreamBody(req *http.Request, generator func(r *http.Request, w io.Writer) error) *streamBody {
+	pr, pw := io.Pipe()
+
+	body := &streamBody{
+		PipeReader: pr,
+		done:       make(chan struct{}),
+	}
+
+	go func() {
+		err := generator(req, pw)
+
+		close(body.done)
+
+		pw.CloseWithError(err)
+	}()
+
+	// abort body reading when request canceled
+	if ctxdone := req.Context().Done(); ctxdone != nil {
+		go func() {
+			select {
+			case <-ctxdone:
+				pw.CloseWithError(req.Context().Err())
+
+			case <-body.done:
+			}
+		}()
+	}
+
+	return body
+}
+
+// contextBody wraps reader which aborts reading when request canceled.
+type contextBody struct {
+	io.Reader
+
+	req *http.Request
+}
+
+func (body *contextBody) Read(p []byte) (int, error) {
+	if err := body.req.Context().Err(); err != nil {
+		return 0, err
+	}
+
+	return body.Reader.Read(p)
+}
+
+func (body *contextBody) Close() error {
+	return nil
+}
+
+// syntheticReader generates deterministic bytes without allocating them.
+type syntheticReader struct {
+	offset int64
+	size   int64
+}
+
+// NewSyntheticReader returns an io.Reader which yields size bytes of deterministic data.
+func NewSyntheticReader(size int64) io.Reader {
+	return &syntheticReader{
+		size: size,
+	}
+}
+
+func (sr *syntheticReader) Read(p []byte) (n int, err error) {
+	if sr.offset >= sr.size {
+		return 0, io.EOF
+	}
+
+	if remain := sr.size - sr.offset; int64(len(p)) > remain {
+		p = p[:remain]
+	}
+
+	for i := range p {
+		p[i] = syntheticByte(sr.offset + int64(i))
+	}
+
+	n = len(p)
+	sr.offset += int64(n)
+
+	return
+}
+
+func syntheticByte(offset int64) byte {
+	return byte(offset ^ offset>>8 ^ offset>>16 ^ offset>>24)
+}
+
+// sleepWithRequest waits for d with clock of r, it aborts if r canceled.
+func sleepWithRequest(r *http.Request, d time.Duration) error {
+	clock := RequestClock(r)
+
+	ch := clock.After(d)
+	select {
+	case <-ch:
+		return nil
+
+	case <-r.Context().Done():
+		// NOTE: remove delay of canceled request, which is counted by FakeClock.Waiters() otherwise
+		if stopper, ok := clock.(clockStopper); ok {
+			stopper.Stop(ch)
+		}
+
+		return r.Context().Err()
+	}
+}
@@ -0,0 +1,113 @@
+package httpmitm
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+)
+
+func Test_NewChunkedResponder(t *testing.T) {
+	it := assert.New(t)
+
+	responder := NewChunkedResponder(200, nil, 10*time.Millisecond, []byte("Hello, "), []byte("world!"))
+	it.Implements((*http.RoundTripper)(nil), responder)
+
+	request, _ := http.NewRequest("GET", mockURL, nil)
+
+	started := time.Now()
+
+	response, err := responder.RoundTrip(request)
+	it.Nil(err)
+	it.Equal(200, response.StatusCode)
+	it.Equal(int64(-1), response.ContentLength)
+	it.Equal([]string{"chunked"}, response.TransferEncoding)
+	it.Empty(response.Header.Get("Content-Length"))
+
+	b, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	it.Nil(err)
+	it.Equal("Hello, world!", string(b))
+	it.True(time.Since(started) >= 10*time.Millisecond)
+}
+
+func Test_NewChannelResponder(t *testing.T) {
+	it := assert.New(t)
+
+	ch := make(chan []byte)
+	go func() {
+		defer close(ch)
+
+		for _, chunk := range []string{`{"id":1}`, "\n", `{"id":2}`} {
+			ch <- []byte(chunk)
+		}
+	}()
+
+	responder := NewChannelResponder(200, nil, ch)
+
+	request, _ := http.NewRequest("GET", mockURL, nil)
+	response, err := responder.RoundTrip(request)
+	it.Nil(err)
+
+	b, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	it.Nil(err)
+	it.Equal("{\"id\":1}\n{\"id\":2}", string(b))
+}
+
+func Test_NewGeneratorResponderWithCanceled(t *testing.T) {
+	it := assert.New(t)
+
+	responder := NewGeneratorResponder(200, nil, func(r *http.Request, w io.Writer) error {
+		w.Write([]byte("first"))
+
+		<-r.Context().Done()
+
+		return r.Context().Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	request, _ := http.NewRequestWithContext(ctx, "GET", mockURL, nil)
+	response, err := responder.RoundTrip(request)
+	it.Nil(err)
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(response.Body, buf)
+	it.Nil(err)
+	it.Equal("first", string(buf))
+
+	cancel()
+
+	_, err = io.ReadAll(response.Body)
+	it.EqualError(err, context.Canceled.Error())
+	response.Body.Close()
+}
+
+func Test_NewSyntheticResponder(t *testing.T) {
+	it := assert.New(t)
+
+	size := int64(1 << 20)
+
+	responder := NewSyntheticResponder(200, nil, size)
+
+	request, _ := http.NewRequest("GET", mockURL, nil)
+	response, err := responder.RoundTrip(request)
+	it.Nil(err)
+	it.Equal(size, response.ContentLength)
+	it.Equal("1048576", response.Header.Get("Content-Length"))
+	it.Empty(response.TransferEncoding)
+
+	b, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	it.Nil(err)
+	it.Equal(int(size), len(b))
+
+	// deterministic
+	expected, _ := io.ReadAll(NewSyntheticReader(size))
+	it.True(bytes.Equal(expected, b))
+}
@@ -0,0 +1,124 @@
+package httpmitm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"sync"
+)
+
+var (
+	defaultCA     *CertificateAuthority
+	defaultCAErr  error
+	defaultCAOnce sync.Once
+)
+
+// defaultCertificateAuthority returns CA shared by mocks without CA, it's generated on the first call.
+func defaultCertificateAuthority() (*CertificateAuthority, error) {
+	defaultCAOnce.Do(func() {
+		defaultCA, defaultCAErr = NewCertificateAuthority()
+	})
+
+	return defaultCA, defaultCAErr
+}
+
+// WithCertificateAuthority mints peer certificates of https mocks with ca, a shared CA is generated on the fly by default.
+// NOTE: Use ca.CertPool() for verifying resp.TLS.PeerCertificates of mocked responses.
+func (mitm *MitmTransport) WithCertificateAuthority(ca *CertificateAuthority) *MitmTransport {
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	mitm.ca = ca
+
+	return mitm
+}
+
+// WithCertificates apply peer certificate chain of resp.TLS for current stub, the leaf first.
+// It's useful for testing certificate pinning with a chain other than the pinned one.
+func (mitm *MitmTransport) WithCertificates(chain ...*x509.Certificate) *MitmTransport {
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	mitm.ensureChained()
+
+	mocker := mitm.lastMocker()
+	if mocker == nil {
+		panic(ErrResponse.Error())
+	}
+
+	mocker.SetCertificates(chain...)
+
+	return mitm
+}
+
+// WithCertificateError fails TLS handshake of current stub with *tls.CertificateVerificationError of err,
+// e.g. for mocking failure of certificate pinning. It defaults to x509.UnknownAuthorityError if err is nil.
+func (mitm *MitmTransport) WithCertificateError(err error) *MitmTransport {
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	mitm.ensureChained()
+
+	mocker := mitm.lastMocker()
+	if mocker == nil {
+		panic(ErrResponse.Error())
+	}
+
+	mocker.SetCertificateError(err)
+
+	return mitm
+}
+
+// connectionState returns TLS state of https mocker, or error of failed handshake.
+// NOTE: It must be called with lock of the mocker held.
+func (m *Mocker) connectionState(ca *CertificateAuthority) (*tls.ConnectionState, error) {
+	hostname, _ := originHostPort(m.rawurl, m.originScheme)
+
+	chain := m.certificates
+	if len(chain) == 0 {
+		if ca == nil {
+			var err error
+
+			ca, err = defaultCertificateAuthority()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var err error
+
+		chain, err = ca.Chain(hostname)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	protocol := "http/1.1"
+	if m.proto == ProtoHTTP2 {
+		protocol = "h2"
+	}
+
+	state := &tls.ConnectionState{
+		Version:            tls.VersionTLS13,
+		CipherSuite:        tls.TLS_AES_128_GCM_SHA256,
+		NegotiatedProtocol: protocol,
+		ServerName:         hostname,
+		PeerCertificates:   chain,
+	}
+
+	if m.certificateErr != nil || m.certificateFailed {
+		err := m.certificateErr
+		if err == nil {
+			err = x509.UnknownAuthorityError{Cert: chain[0]}
+		}
+
+		return state, &tls.CertificateVerificationError{
+			UnverifiedCertificates: chain,
+			Err:                    err,
+		}
+	}
+
+	state.HandshakeComplete = true
+	state.VerifiedChains = [][]*x509.Certificate{chain}
+
+	return state, nil
+}
@@ -0,0 +1,157 @@
+package httpmitm
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptrace"
+	"testing"
+
+	"github.com/golib/assert"
+)
+
+func Test_MitmTransportWithTLS(t *testing.T) {
+	mt := NewMitmTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, nil, "")
+	mt.MockRequest("GET", "http://www.example.com/users").WithResponse(200, nil, "")
+
+	client := &http.Client{Transport: mt}
+
+	response, err := client.Get("mitm://api.example.com/users")
+	if it.Nil(err) {
+		response.Body.Close()
+
+		if it.NotNil(response.TLS) {
+			it.True(response.TLS.HandshakeComplete)
+			it.Equal(uint16(tls.VersionTLS13), response.TLS.Version)
+			it.Equal("api.example.com", response.TLS.ServerName)
+			it.Equal("http/1.1", response.TLS.NegotiatedProtocol)
+
+			if it.Equal(2, len(response.TLS.PeerCertificates)) {
+				it.Nil(response.TLS.PeerCertificates[0].VerifyHostname("api.example.com"))
+				it.True(response.TLS.PeerCertificates[1].IsCA)
+			}
+			it.Equal(1, len(response.TLS.VerifiedChains))
+		}
+	}
+
+	response, err = client.Get("mitm://www.example.com/users")
+	if it.Nil(err) {
+		response.Body.Close()
+
+		it.Nil(response.TLS)
+	}
+}
+
+func Test_MitmTransportWithCertificateAuthority(t *testing.T) {
+	ca, err := NewCertificateAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mt := NewMitmTransport().WithCertificateAuthority(ca)
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, nil, "").AnyTimes()
+
+	client := &http.Client{Transport: mt}
+
+	response, err := client.Get("mitm://api.example.com/users")
+	if it.Nil(err) {
+		response.Body.Close()
+
+		_, err = response.TLS.PeerCertificates[0].Verify(x509.VerifyOptions{
+			DNSName: "api.example.com",
+			Roots:   ca.CertPool(),
+		})
+		it.Nil(err)
+	}
+}
+
+func Test_MitmTransportWithCertificates(t *testing.T) {
+	pinned, err := NewCertificateAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := NewCertificateAuthority()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain, err := other.Chain("api.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pin := sha256.Sum256(pinned.Certificate.RawSubjectPublicKeyInfo)
+
+	mt := NewMitmTransport().WithCertificateAuthority(pinned)
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, nil, "").WithCertificates(chain...)
+
+	client := &http.Client{Transport: mt}
+
+	response, err := client.Get("mitm://api.example.com/users")
+	if it.Nil(err) {
+		response.Body.Close()
+
+		it.Equal(chain, response.TLS.PeerCertificates)
+		it.NotEqual(pin, sha256.Sum256(response.TLS.PeerCertificates[1].RawSubjectPublicKeyInfo))
+	}
+}
+
+func Test_MitmTransportWithCertificateError(t *testing.T) {
+	mt := NewMitmTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, nil, "").WithCertificateError(nil)
+
+	trace, events := newRecordingTrace()
+
+	var handshakeErr error
+	trace.TLSHandshakeDone = func(state tls.ConnectionState, err error) {
+		handshakeErr = err
+	}
+
+	request, _ := http.NewRequest("GET", "mitm://api.example.com/users", nil)
+	request = request.WithContext(httptrace.WithClientTrace(request.Context(), trace))
+
+	_, err := (&http.Client{Transport: mt}).Do(request)
+	if it.NotNil(err) {
+		var verifyErr *tls.CertificateVerificationError
+		if it.True(errors.As(err, &verifyErr)) {
+			it.Equal(2, len(verifyErr.UnverifiedCertificates))
+		}
+
+		var authorityErr x509.UnknownAuthorityError
+		it.True(errors.As(err, &authorityErr))
+	}
+	it.NotNil(handshakeErr)
+
+	it.Equal([]string{
+		"GetConn api.example.com:443",
+		"DNSStart api.example.com",
+		"DNSDone 127.0.0.1",
+		"ConnectStart tcp 127.0.0.1:443",
+		"ConnectDone tcp 127.0.0.1:443",
+		"TLSHandshakeStart",
+	}, events())
+
+	// custom error
+	pinningErr := errors.New("certificate pinning failure")
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, nil, "").WithCertificateError(pinningErr)
+
+	_, err = (&http.Client{Transport: mt}).Get("mitm://api.example.com/users")
+	it.True(errors.Is(err, pinningErr))
+}
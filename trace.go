@@ -0,0 +1,162 @@
+package httpmitm
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TraceTimings defines simulated timings of httptrace.ClientTrace events for mocked round trips.
+// NOTE: TLS is only simulated for mocks of https origin.
+type TraceTimings struct {
+	DNS       time.Duration // between DNSStart and DNSDone
+	Connect   time.Duration // between ConnectStart and ConnectDone
+	TLS       time.Duration // between TLSHandshakeStart and TLSHandshakeDone
+	FirstByte time.Duration // between WroteRequest and GotFirstResponseByte, excluding delay of responder
+}
+
+// WithTraceTimings apply simulated timings of httptrace.ClientTrace events for current stub.
+func (mitm *MitmTransport) WithTraceTimings(timings TraceTimings) *MitmTransport {
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	mitm.ensureChained()
+
+	mocker := mitm.lastMocker()
+	if mocker == nil {
+		panic(ErrResponse.Error())
+	}
+
+	mocker.SetTraceTimings(timings)
+
+	return mitm
+}
+
+// traceConnect invokes connection events of trace in order of a fresh connection, it returns error if request canceled.
+// TLS events are invoked only if state or tlsErr is given.
+func traceConnect(r *http.Request, trace *httptrace.ClientTrace, rawurl, scheme string, state *tls.ConnectionState, tlsErr error, timings TraceTimings) error {
+	hostname, port := originHostPort(rawurl, scheme)
+
+	ip := net.ParseIP(hostname)
+	if ip == nil {
+		ip = net.IPv4(127, 0, 0, 1)
+	}
+
+	addr := net.JoinHostPort(ip.String(), port)
+
+	if trace.GetConn != nil {
+		trace.GetConn(net.JoinHostPort(hostname, port))
+	}
+
+	if trace.DNSStart != nil {
+		trace.DNSStart(httptrace.DNSStartInfo{Host: hostname})
+	}
+	err := sleepWithRequest(r, timings.DNS)
+	if trace.DNSDone != nil {
+		trace.DNSDone(httptrace.DNSDoneInfo{Addrs: []net.IPAddr{{IP: ip}}, Err: err})
+	}
+	if err != nil {
+		return err
+	}
+
+	if trace.ConnectStart != nil {
+		trace.ConnectStart("tcp", addr)
+	}
+	err = sleepWithRequest(r, timings.Connect)
+	if trace.ConnectDone != nil {
+		trace.ConnectDone("tcp", addr, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if state != nil || tlsErr != nil {
+		if trace.TLSHandshakeStart != nil {
+			trace.TLSHandshakeStart()
+		}
+
+		err = sleepWithRequest(r, timings.TLS)
+		if trace.TLSHandshakeDone != nil {
+			var done tls.ConnectionState
+			if state != nil {
+				done = *state
+			}
+
+			handshakeErr := err
+			if handshakeErr == nil {
+				handshakeErr = tlsErr
+			}
+
+			trace.TLSHandshakeDone(done, handshakeErr)
+		}
+		if err != nil {
+			return err
+		}
+
+		// NOTE: request is never written after failed handshake, which is reported by caller
+		if tlsErr != nil {
+			return nil
+		}
+	}
+
+	if trace.GotConn != nil {
+		remote := &net.TCPAddr{IP: ip}
+		remote.Port, _ = strconv.Atoi(port)
+
+		trace.GotConn(httptrace.GotConnInfo{
+			Conn: &traceConn{
+				local:  &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)},
+				remote: remote,
+			},
+		})
+	}
+
+	if trace.WroteHeaders != nil {
+		trace.WroteHeaders()
+	}
+	if trace.WroteRequest != nil {
+		trace.WroteRequest(httptrace.WroteRequestInfo{})
+	}
+
+	return sleepWithRequest(r, timings.FirstByte)
+}
+
+// originHostPort returns hostname and port of rawurl, port defaults to well-known port of scheme.
+func originHostPort(rawurl, scheme string) (hostname, port string) {
+	host := rawurl
+	if urlobj, err := url.Parse(rawurl); err == nil {
+		host = urlobj.Host
+	}
+
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname = host
+
+		port = "80"
+		if scheme == "https" {
+			port = "443"
+		}
+	}
+
+	return strings.Trim(hostname, "[]"), port
+}
+
+// traceConn is the simulated connection reported by GotConn of trace, it's neither readable nor writable.
+type traceConn struct {
+	local  net.Addr
+	remote net.Addr
+}
+
+func (c *traceConn) Read(p []byte) (int, error)         { return 0, net.ErrClosed }
+func (c *traceConn) Write(p []byte) (int, error)        { return 0, net.ErrClosed }
+func (c *traceConn) Close() error                       { return nil }
+func (c *traceConn) LocalAddr() net.Addr                { return c.local }
+func (c *traceConn) RemoteAddr() net.Addr               { return c.remote }
+func (c *traceConn) SetDeadline(t time.Time) error      { return nil }
+func (c *traceConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *traceConn) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,171 @@
+package httpmitm
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+)
+
+func newRecordingTrace() (*httptrace.ClientTrace, func() []string) {
+	var (
+		mux    sync.Mutex
+		events []string
+	)
+
+	add := func(event string) {
+		mux.Lock()
+		defer mux.Unlock()
+
+		events = append(events, event)
+	}
+
+	trace := &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			add("GetConn " + hostPort)
+		},
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			add("DNSStart " + info.Host)
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			add("DNSDone " + info.Addrs[0].String())
+		},
+		ConnectStart: func(network, addr string) {
+			add("ConnectStart " + network + " " + addr)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			add("ConnectDone " + network + " " + addr)
+		},
+		TLSHandshakeStart: func() {
+			add("TLSHandshakeStart")
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			add("TLSHandshakeDone " + state.ServerName)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			add("GotConn " + info.Conn.RemoteAddr().String())
+		},
+		WroteHeaders: func() {
+			add("WroteHeaders")
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			add("WroteRequest")
+		},
+		GotFirstResponseByte: func() {
+			add("GotFirstResponseByte")
+		},
+	}
+
+	return trace, func() []string {
+		mux.Lock()
+		defer mux.Unlock()
+
+		return events
+	}
+}
+
+func Test_MitmTransportWithTraceTimings(t *testing.T) {
+	mt := NewMitmTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, nil, "").WithTraceTimings(TraceTimings{
+		DNS:       10 * time.Millisecond,
+		Connect:   10 * time.Millisecond,
+		TLS:       10 * time.Millisecond,
+		FirstByte: 10 * time.Millisecond,
+	})
+
+	trace, events := newRecordingTrace()
+
+	request, _ := http.NewRequest("GET", "mitm://api.example.com/users", nil)
+	request = request.WithContext(httptrace.WithClientTrace(request.Context(), trace))
+
+	start := time.Now()
+
+	response, err := mt.RoundTrip(request)
+	if it.Nil(err) {
+		response.Body.Close()
+
+		it.Equal(200, response.StatusCode)
+	}
+	it.True(time.Since(start) >= 40*time.Millisecond)
+
+	it.Equal([]string{
+		"GetConn api.example.com:443",
+		"DNSStart api.example.com",
+		"DNSDone 127.0.0.1",
+		"ConnectStart tcp 127.0.0.1:443",
+		"ConnectDone tcp 127.0.0.1:443",
+		"TLSHandshakeStart",
+		"TLSHandshakeDone api.example.com",
+		"GotConn 127.0.0.1:443",
+		"WroteHeaders",
+		"WroteRequest",
+		"GotFirstResponseByte",
+	}, events())
+}
+
+func Test_MitmTransportTraceWithHTTP(t *testing.T) {
+	mt := NewMitmTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "http://10.0.0.1:8080/users").WithResponse(200, nil, "")
+
+	trace, events := newRecordingTrace()
+
+	request, _ := http.NewRequest("GET", "mitm://10.0.0.1:8080/users", nil)
+	request = request.WithContext(httptrace.WithClientTrace(request.Context(), trace))
+
+	response, err := mt.RoundTrip(request)
+	if it.Nil(err) {
+		response.Body.Close()
+	}
+
+	it.Equal([]string{
+		"GetConn 10.0.0.1:8080",
+		"DNSStart 10.0.0.1",
+		"DNSDone 10.0.0.1",
+		"ConnectStart tcp 10.0.0.1:8080",
+		"ConnectDone tcp 10.0.0.1:8080",
+		"GotConn 10.0.0.1:8080",
+		"WroteHeaders",
+		"WroteRequest",
+		"GotFirstResponseByte",
+	}, events())
+}
+
+func Test_MitmTransportTraceWithCanceled(t *testing.T) {
+	mt := NewMitmTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://api.example.com/users").WithResponse(200, nil, "").WithTraceTimings(TraceTimings{
+		Connect: time.Second,
+	})
+
+	trace, events := newRecordingTrace()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	request, _ := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), "GET", "mitm://api.example.com/users", nil)
+
+	_, err := mt.RoundTrip(request)
+	it.True(errors.Is(err, context.DeadlineExceeded))
+
+	it.Equal([]string{
+		"GetConn api.example.com:443",
+		"DNSStart api.example.com",
+		"DNSDone 127.0.0.1",
+		"ConnectStart tcp 127.0.0.1:443",
+		"ConnectDone tcp 127.0.0.1:443",
+	}, events())
+}
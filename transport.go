@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"os"
 	"path/filepath"
 	"runtime"
 	"strconv"
@@ -14,6 +15,7 @@ import (
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // MitmTransport implements http.RoundTripper, which hijacks http request issued by an http.Client with mitm scheme.
@@ -21,23 +23,46 @@ import (
 type MitmTransport struct {
 	mux sync.Mutex
 
-	testing *testing.T
+	testing     *testing.T
+	leakTesting testing.TB // t of WithResponseLeakCheck, which fails by UnstubDefaultTransport if not stubbed
 
 	stubs   map[string]*Responser // responders registered for MITM request
 	stubbed atomic.Bool           // indicate whether http.DefaultTransport stubbed?
 	paused  atomic.Bool           // indicate whether current mocked transport paused?
 	mocked  atomic.Bool           // indicate whether current chain finished?
 
+	scenarios map[string]*Scenario // scenarios shared by stubs
+	contract  *Contract            // contract validating mocked requests
+	clock     Clock                // clock of time-dependent mocks, nil for RealClock
+	chaos     *ChaosPolicy         // policy injecting faults into responses, nil for none
+
+	historyMux sync.Mutex
+	history    []*RequestRecord // requests issued with mitm scheme, the latest last
+
+	observers observers // observers of requests issued with mitm scheme
+
+	ca *CertificateAuthority // CA minting peer certificates of https mocks, nil for a shared one
+
+	closeCheck atomic.Bool // indicate whether response bodies of mocks must be closed?
+	drainCheck atomic.Bool // indicate whether response bodies of mocks must be drained?
+	bodiesMux  sync.Mutex
+	bodies     []*trackedBody // response bodies of mocks tracked for close check
+
 	lastMockedMethod  string
 	lastMockedURL     string
 	lastMockedMatcher RequestMatcher
 	lastMockedTimes   int
+
+	lastMockedScenario  string
+	lastMockedWhenState string
+	lastMockedThenState string
 }
 
 // NewMitmTransport creates MitmTransport for stubs && mocks.
 func NewMitmTransport() *MitmTransport {
 	return &MitmTransport{
 		stubs:             make(map[string]*Responser),
+		scenarios:         make(map[string]*Scenario),
 		lastMockedMethod:  "",
 		lastMockedURL:     "",
 		lastMockedMatcher: DefaultMatcher,
@@ -58,64 +83,112 @@ func (mitm *MitmTransport) StubDefaultTransport(t *testing.T) *MitmTransport {
 
 // UnstubDefaultTransport restores http.DefaultTransport
 func (mitm *MitmTransport) UnstubDefaultTransport() {
+	var (
+		obs      observers
+		failures []*failedExpectation
+	)
+
+	// NOTE: observers are notified without lock, which may call back into the transport, e.g. Snapshot()
+	defer func() {
+		for _, failure := range failures {
+			obs.expectationFailure(nil, failure.method, failure.mocker, failure.err)
+		}
+	}()
+
 	mitm.mux.Lock()
 	defer mitm.mux.Unlock()
 
+	obs = mitm.observers
+
 	if mitm.stubbed.Swap(false) {
 		http.DefaultTransport = httpDefaultResponder
 	}
 
+	var errlogs []string
+
 	// is times missing match?
 	if !mitm.paused.Load() {
-		var errlogs []string
-
 		for key, stubs := range mitm.stubs {
-			for path, mocker := range stubs.Mocks() {
-				if mocker.IsTimesExceed() {
-					key = strings.Replace(key, MockScheme, mocker.Scheme(), 1)
-					expected, invoked := mocker.Times()
-
-					errlogs = append(errlogs, DefaultLeaddingSpace+"Error Trace:    %s:%d\n"+DefaultLeaddingSpace+"Error:          Expected "+key+path+" with "+fmt.Sprintf("%d", expected)+" times, but got "+fmt.Sprintf("%d", invoked)+" times\n")
+			for path, mocks := range stubs.Mocks() {
+				for _, mocker := range mocks.Alternatives() {
+					if mocker.IsTimesExceed() {
+						key = strings.Replace(key, MockScheme, mocker.Scheme(), 1)
+						expected, invoked := mocker.Times()
+
+						errlogs = append(errlogs, DefaultLeaddingSpace+"Error Trace:    %s:%d\n"+DefaultLeaddingSpace+"Error:          Expected "+key+path+" with "+fmt.Sprintf("%d", expected)+" times, but got "+fmt.Sprintf("%d", invoked)+" times\n")
+
+						method, _, _ := strings.Cut(key, " ")
+						failures = append(failures, &failedExpectation{
+							method: method,
+							mocker: mocker,
+							err: &ExpectationError{
+								Method:   method,
+								URL:      mocker.RawURL(),
+								Expected: expected,
+								Invoked:  invoked,
+							},
+						})
+					}
 				}
 			}
 		}
+	}
 
-		if len(errlogs) > 0 {
-			pcs := make([]uintptr, 20)
-			frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
-
-			var (
-				frame runtime.Frame
-				more  bool
-			)
-			for {
-				tmpframe, tmpmore := frames.Next()
-				if strings.HasPrefix(tmpframe.Function, "testing.") {
-					if !tmpmore {
-						frame, more = tmpframe, tmpmore
-					}
+	// is response body of mocks leaked?
+	for _, leak := range mitm.ResponseLeaks() {
+		errlogs = append(errlogs, DefaultLeaddingSpace+"Error Trace:    %s:%d\n"+DefaultLeaddingSpace+"Error:          Expected "+strings.ReplaceAll(leak.String(), "%", "%%"))
+	}
+	mitm.resetResponses()
 
-					break
-				}
+	if len(errlogs) > 0 {
+		pcs := make([]uintptr, 20)
+		frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
 
-				frame, more = tmpframe, tmpmore
-				if !more {
-					break
+		var (
+			frame runtime.Frame
+			more  bool
+		)
+		for {
+			tmpframe, tmpmore := frames.Next()
+			if strings.HasPrefix(tmpframe.Function, "testing.") {
+				if !tmpmore {
+					frame, more = tmpframe, tmpmore
 				}
+
+				break
 			}
 
-			// format errlogs
-			for i, errlog := range errlogs {
-				errlogs[i] = fmt.Sprintf(errlog, filepath.Base(frame.File), frame.Line)
+			frame, more = tmpframe, tmpmore
+			if !more {
+				break
 			}
+		}
+
+		// format errlogs
+		for i, errlog := range errlogs {
+			errlogs[i] = fmt.Sprintf(errlog, filepath.Base(frame.File), frame.Line)
+		}
+
+		fmt.Printf("--- FAIL: %s\n%s\n", filepath.Base(frame.Function), strings.Join(errlogs, "\n"))
 
-			fmt.Printf("--- FAIL: %s\n%s\n", filepath.Base(frame.Function), strings.Join(errlogs, "\n"))
+		// NOTE: there is no t for transport used without StubDefaultTransport, e.g. server mode
+		switch {
+		case mitm.testing != nil:
 			mitm.testing.Fail()
+
+		case mitm.leakTesting != nil:
+			mitm.leakTesting.Fail()
 		}
 	}
 
 	mitm.stubs = make(map[string]*Responser)
+	mitm.scenarios = make(map[string]*Scenario)
+	mitm.contract = nil
 	mitm.testing = nil
+
+	mitm.historyMux.Lock()
+	mitm.history = nil
+	mitm.historyMux.Unlock()
 }
 
 // MockRequest stubs resource with request method
@@ -145,6 +218,9 @@ func (mitm *MitmTransport) MockRequest(method, rawurl string) *MitmTransport {
 	mitm.lastMockedURL = rawurl
 	mitm.lastMockedMatcher = DefaultMatcher
 	mitm.lastMockedTimes = MockDefaultTimes
+	mitm.lastMockedScenario = ""
+	mitm.lastMockedWhenState = ""
+	mitm.lastMockedThenState = ""
 
 	return mitm
 }
@@ -156,12 +232,9 @@ func (mitm *MitmTransport) ByMatcher(matcher func(r *http.Request, urlobj *url.U
 
 	mitm.ensureChained()
 
-	// modify mocked matcher
-	lastKey, _ := mitm.calcRequestKey(mitm.lastMockedMethod, mitm.lastMockedURL)
-
-	responser, ok := mitm.stubs[lastKey]
-	if ok {
-		responser.SetMatcherByRawURL(mitm.lastMockedURL, matcher)
+	// modify mocked matcher, it's applied by WithResponser if not mocked yet
+	if mocker := mitm.lastMocker(); mocker != nil {
+		mocker.SetMatcher(matcher)
 	} else {
 		mitm.lastMockedMatcher = matcher
 	}
@@ -180,12 +253,9 @@ func (mitm *MitmTransport) Times(i int) *MitmTransport {
 		panic(ErrTimes.Error())
 	}
 
-	// modify mocked times
-	lastKey, _ := mitm.calcRequestKey(mitm.lastMockedMethod, mitm.lastMockedURL)
-
-	responser, ok := mitm.stubs[lastKey]
-	if ok {
-		responser.SetExpectedTimesByRawURL(mitm.lastMockedURL, i)
+	// modify mocked times, it's applied by WithResponser if not mocked yet
+	if mocker := mitm.lastMocker(); mocker != nil {
+		mocker.SetExpectedTimes(i)
 	} else {
 		mitm.lastMockedTimes = i
 	}
@@ -208,7 +278,15 @@ func (mitm *MitmTransport) WithResponser(responder http.RoundTripper) *MitmTrans
 	key, _ := mitm.calcRequestKey(mitm.lastMockedMethod, mitm.lastMockedURL)
 
 	if mitm.stubs[key] == nil || mitm.stubs[key] == RefusedResponser {
-		mitm.stubs[key] = NewResponser(responder, mitm.lastMockedURL, mitm.lastMockedTimes)
+		mitm.stubs[key] = &Responser{
+			mocks: make(map[string]*Mocker),
+		}
+	}
+
+	if mitm.lastMockedScenario != "" || mitm.lastMockedWhenState != "" || mitm.lastMockedThenState != "" {
+		scenario := mitm.lookupScenario(mitm.lastMockedScenario)
+
+		mitm.stubs[key].NewInScenario(responder, mitm.lastMockedURL, mitm.lastMockedTimes, scenario, mitm.lastMockedWhenState, mitm.lastMockedThenState)
 	} else {
 		mitm.stubs[key].New(responder, mitm.lastMockedURL, mitm.lastMockedTimes)
 	}
@@ -240,6 +318,26 @@ func (mitm *MitmTransport) WithCalleeResponse(callee func(r *http.Request) (code
 	return mitm.WithResponser(NewCalleeResponder(callee))
 }
 
+// WithChunkedResponse apply http chunked response with delay between chunks for current stub
+func (mitm *MitmTransport) WithChunkedResponse(code int, header http.Header, delay time.Duration, chunks ...[]byte) *MitmTransport {
+	return mitm.WithResponser(NewChunkedResponder(code, header, delay, chunks...))
+}
+
+// WithSyntheticResponse apply http response with size bytes of deterministic data for current stub
+func (mitm *MitmTransport) WithSyntheticResponse(code int, header http.Header, size int64) *MitmTransport {
+	return mitm.WithResponser(NewSyntheticResponder(code, header, size))
+}
+
+// WithCompressedResponse apply http response compressed according to Accept-Encoding of request for current stub
+func (mitm *MitmTransport) WithCompressedResponse(code int, header http.Header, body interface{}) *MitmTransport {
+	return mitm.WithResponser(NewEncodingResponder(NewResponder(code, header, body)))
+}
+
+// WithSSEResponse apply text/event-stream response of events for current stub
+func (mitm *MitmTransport) WithSSEResponse(events ...SSEEvent) *MitmTransport {
+	return mitm.WithResponser(NewSSEResponder(events...))
+}
+
 // RoundTrip implments http.RoundTripper
 func (mitm *MitmTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 	// direct connection for none mitm scheme
@@ -247,13 +345,49 @@ func (mitm *MitmTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 		return httpDefaultResponder.RoundTrip(r)
 	}
 
+	obs := mitm.observer()
+	obs.request(r)
+
+	record := mitm.newRequestRecord(r)
+
+	req, body, err := bufferRequest(r)
+	if err != nil {
+		mitm.addRequestRecord(record, nil, err)
+
+		return nil, err
+	}
+	record.Body = string(body)
+
+	req = withClock(req, mitm.Clock())
+
+	resp, err := mitm.roundTrip(req, obs, record)
+
+	mitm.addRequestRecord(record, resp, err)
+
+	if resp != nil {
+		obs.response(r, resp, record.Duration)
+	}
+
+	return resp, err
+}
+
+func (mitm *MitmTransport) roundTrip(r *http.Request, obs observers, record *RequestRecord) (*http.Response, error) {
+	mitm.mux.Lock()
 	response, ok := mitm.stubs[mitm.normalizeKey(r.Method, MockScheme, r.URL.Host)]
+	ca := mitm.ca
+	chaos := mitm.chaos
+	contract := mitm.contract
+	mitm.mux.Unlock()
 	if !ok {
+		obs.unmatched(r, ErrRefused)
+
 		return RefusedResponser.RoundTrip(r)
 	}
 
 	mocker := response.Find(r.URL.Path)
 	if mocker == nil {
+		obs.unmatched(r, ErrNotFound)
+
 		return NotFoundResponser.RoundTrip(r)
 	}
 
@@ -262,7 +396,11 @@ func (mitm *MitmTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 		// adjust request url scheme
 		r.URL.Scheme = mocker.Scheme()
 
-		resp, err := httpDefaultResponder.RoundTrip(r)
+		obs.passthrough(r, PassthroughPaused)
+
+		resp, err := chaos.roundTrip(r, r.URL.String(), true, httpDefaultResponder.RoundTrip, func(injection *ChaosInjection) {
+			obs.errorInjected(r, mocker, &ChaosError{Injection: injection})
+		})
 		if err != nil {
 			return resp, err
 		}
@@ -307,16 +445,94 @@ func (mitm *MitmTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 		resp.Body = io.NopCloser(bytes.NewBuffer(data))
 
 		// invoke testdata writer
-		if werr := responder.Write(r.Method, r.URL, data); werr != nil {
-			mitm.testing.Logf("Response writes %s %s with: %v", r.Method, r.URL.String(), werr)
-		} else {
-			mitm.testing.Logf("Response write %s %s OK!", r.Method, r.URL.String())
+		werr := responder.Write(r.Method, r.URL, data)
+		if mitm.testing != nil {
+			if werr != nil {
+				mitm.testing.Logf("Response writes %s %s with: %v", r.Method, r.URL.String(), werr)
+			} else {
+				mitm.testing.Logf("Response write %s %s OK!", r.Method, r.URL.String())
+			}
 		}
 
 		return resp, err
 	}
 
-	return mocker.RoundTrip(r)
+	if err := mitm.validateRequest(r, contract, mocker); err != nil {
+		obs.expectationFailure(r, r.Method, mocker.resolve(), err)
+
+		return nil, err
+	}
+
+	target := mocker.resolve()
+	if target == nil {
+		obs.unmatched(r, ErrNotFound)
+
+		return NotFoundResponser.RoundTrip(r)
+	}
+
+	// NOTE: faults injected within the round trip are reported after its outcome, truncation of body may be reported later.
+	var (
+		injections []*ChaosInjection
+		reported   bool
+	)
+
+	outcome, resp, err := target.roundTrip(r, ca, chaos, func(injection *ChaosInjection) {
+		if reported {
+			obs.errorInjected(r, target, &ChaosError{Injection: injection})
+			return
+		}
+
+		injections = append(injections, injection)
+	})
+	reported = true
+
+	switch outcome {
+	case mockUnmatched:
+		obs.unmatched(r, ErrNotFound)
+
+	case mockExceeded:
+		expected, invoked := target.Times()
+
+		obs.expectationFailure(r, r.Method, target, &ExpectationError{
+			Method:   strings.ToUpper(r.Method),
+			URL:      target.RawURL(),
+			Expected: expected,
+			Invoked:  invoked,
+		})
+		obs.passthrough(r, PassthroughExceeded)
+
+	default:
+		obs.matched(r, target)
+	}
+
+	var chaosReset bool
+	for _, injection := range injections {
+		chaosReset = chaosReset || injection.Fault == ChaosReset
+
+		obs.errorInjected(r, target, &ChaosError{Injection: injection})
+	}
+
+	// error of reset fault is reported above already
+	if err != nil && outcome == mockMatched && !chaosReset {
+		obs.errorInjected(r, target, err)
+	}
+	if err != nil {
+		return resp, err
+	}
+
+	if err := mitm.validateResponse(r, contract, resp); err != nil {
+		obs.expectationFailure(r, r.Method, target, err)
+
+		return nil, err
+	}
+
+	mitm.rewriteLocation(resp)
+
+	if outcome == mockMatched {
+		mitm.trackResponse(record, resp)
+	}
+
+	return resp, err
 }
 
 // CancelRequest close request mocked
@@ -326,6 +542,7 @@ func (mitm *MitmTransport) CancelRequest(r *http.Request) {
 }
 
 // Pause pauses all stubs of all requests
+// NOTE: It takes no effect if http.DefaultTransport is not stubbed, use SetPaused for transport used directly, e.g. server mode.
 func (mitm *MitmTransport) Pause() {
 	if mitm.stubbed.Load() {
 		mitm.paused.Store(true)
@@ -333,35 +550,70 @@ func (mitm *MitmTransport) Pause() {
 }
 
 // Resume resumes all paused stubs of all requests
+// NOTE: It takes no effect if http.DefaultTransport is not stubbed, use SetPaused for transport used directly, e.g. server mode.
 func (mitm *MitmTransport) Resume() {
 	if mitm.stubbed.Load() {
 		mitm.paused.Store(false)
 	}
 }
 
-// PrettyPrint dumps MitmTransport in well format.
-func (mitm *MitmTransport) PrettyPrint() {
-	buf := bytes.NewBuffer(nil)
-	buf.WriteString("stubs<map[string]&httpmitm.Responder>{\n")
-	for key, stub := range mitm.stubs {
-		buf.WriteString(`    "` + key + `": &httpmitm.Responder{` + "\n")
-		buf.WriteString(`        mocks<map[string]&httpmitm.Mocker>{` + "\n")
-		for subkey, mock := range stub.mocks {
-			tmp := fmt.Sprintf("%#v", mock)
-			tmp = strings.Replace(tmp, `sync.Mutex{state:0, sema:0x0}`, "sync.Mutex()", -1)
-			tmp = strings.Replace(tmp, "{", "{\n                ", -1)
-			tmp = strings.Replace(tmp, ", ", ",\n                ", -1)
-			tmp = strings.Replace(tmp, "}", "\n            }", -1)
-			tmp = strings.Replace(tmp, "sync.Mutex()", `sync.Mutex{state:0, sema:0x0}`, -1)
-
-			buf.WriteString(`            "` + subkey + `": ` + tmp + "\n")
-		}
-		buf.WriteString(`        }` + "\n")
-		buf.WriteString(`    }` + "\n")
+// SetPaused pauses or resumes all stubs of all requests, whether http.DefaultTransport is stubbed or not.
+func (mitm *MitmTransport) SetPaused(paused bool) {
+	mitm.paused.Store(paused)
+}
+
+// IsPaused returns true if all stubs are paused
+func (mitm *MitmTransport) IsPaused() bool {
+	return mitm.paused.Load()
+}
+
+// Unmock removes mock of request method and rawurl, it returns false if not mocked.
+func (mitm *MitmTransport) Unmock(method, rawurl string) bool {
+	mitm.mux.Lock()
+	defer mitm.mux.Unlock()
+
+	key, err := mitm.calcRequestKey(method, rawurl)
+	if err != nil {
+		return false
+	}
+
+	responser, ok := mitm.stubs[key]
+	if !ok || responser == RefusedResponser {
+		return false
 	}
-	buf.WriteString("\n}\n")
 
-	println(buf.String())
+	if !responser.Remove(rawurl) {
+		return false
+	}
+
+	if len(responser.Mocks()) == 0 {
+		delete(mitm.stubs, key)
+	}
+
+	return true
+}
+
+// Reset removes all stubs and request history, and resets all scenarios to started state.
+// NOTE: It's different from UnstubDefaultTransport, which restores http.DefaultTransport and checks invoked times.
+func (mitm *MitmTransport) Reset() {
+	mitm.mux.Lock()
+	mitm.stubs = make(map[string]*Responser)
+	for _, scenario := range mitm.scenarios {
+		scenario.Reset()
+	}
+	mitm.mocked.Store(false)
+	mitm.lastMockedMethod = ""
+	mitm.lastMockedURL = ""
+	mitm.mux.Unlock()
+
+	mitm.ResetHistory()
+	mitm.resetResponses()
+}
+
+// PrettyPrint dumps all registered mocks to stderr in table format.
+// NOTE: Use Snapshot() or Dump() for inspecting mocks programmatically.
+func (mitm *MitmTransport) PrettyPrint() {
+	mitm.Dump(os.Stderr)
 }
 
 func (mitm *MitmTransport) ensureChained() {
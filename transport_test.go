@@ -3,6 +3,7 @@ package httpmitm
 import (
 	"io"
 	"net/http"
+	"net/url"
 	"testing"
 
 	"github.com/golib/assert"
@@ -58,7 +59,8 @@ func Test_MitmTransport(t *testing.T) {
 	response.Body.Close()
 
 	it.Nil(err)
-	it.Equal("PUT OK", string(b))
+	it.Empty(b) // no body of 204 response
+	it.Equal("6", response.Header.Get("Content-Length"))
 
 	// GET /mock
 	response, err = http.Get(stubURL + "/mock")
@@ -260,6 +262,25 @@ func Test_MitmTransportPauseAndResume(t *testing.T) {
 	response.Body.Close()
 }
 
+func Test_MitmTransportPauseWithoutStub(t *testing.T) {
+	mt := NewMitmTransport()
+
+	it := assert.New(t)
+
+	// no effect without stubbing http.DefaultTransport
+	mt.Pause()
+	it.False(mt.IsPaused())
+
+	mt.SetPaused(true)
+	it.True(mt.IsPaused())
+
+	mt.Resume()
+	it.True(mt.IsPaused())
+
+	mt.SetPaused(false)
+	it.False(mt.IsPaused())
+}
+
 func Test_MitmTransportWithTestdataer(t *testing.T) {
 	mt := NewMitmTransport().StubDefaultTransport(t)
 	defer mt.UnstubDefaultTransport()
@@ -275,3 +296,72 @@ func Test_MitmTransportWithTestdataer(t *testing.T) {
 	it.Equal(200, response.StatusCode)
 	// it.ReaderContains(response.Body, "Hello, httpmitm!")
 }
+
+func Test_MitmTransportWithChunkedResponse(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	// mocks
+	mt.MockRequest("GET", mockURL).WithChunkedResponse(200, nil, 0, []byte("MOCK "), []byte("OK"))
+
+	// response with mocked
+	response, err := http.Get(stubURL)
+	it.Nil(err)
+	it.Equal(200, response.StatusCode)
+	it.Equal(int64(-1), response.ContentLength)
+
+	b, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	it.Nil(err)
+	it.Equal("MOCK OK", string(b))
+}
+
+func Test_MitmTransportWithCompressedResponse(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	// mocks
+	mt.MockRequest("GET", mockURL).WithCompressedResponse(200, nil, "MOCK OK")
+
+	// response with mocked
+	request, _ := http.NewRequest("GET", stubURL, nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+
+	response, err := http.DefaultClient.Do(request)
+	it.Nil(err)
+	it.Equal(200, response.StatusCode)
+	it.Equal("gzip", response.Header.Get("Content-Encoding"))
+	response.Body.Close()
+}
+
+func Test_MitmTransportByMatcherWithMockedHost(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	mt.MockRequest("GET", "https://example.com/users").WithResponse(200, nil, "users").Times(2)
+
+	// chain ByMatcher and Times before response for another path of the same host
+	mt.MockRequest("GET", "https://example.com/pages").ByMatcher(func(r *http.Request, urlobj *url.URL) bool {
+		return DefaultMatcher(r, urlobj) && r.URL.Query().Get("page") == "1"
+	}).Times(2).WithResponse(200, nil, "page 1")
+
+	for i := 0; i < 2; i++ {
+		for _, path := range []string{"/users", "/pages?page=1"} {
+			response, err := http.Get("mitm://example.com" + path)
+			if it.Nil(err) {
+				b, _ := io.ReadAll(response.Body)
+				response.Body.Close()
+				it.NotEmpty(b)
+			}
+		}
+	}
+
+	_, err := http.Get("mitm://example.com/pages?page=2")
+	it.NotNil(err)
+}
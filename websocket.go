@@ -0,0 +1,535 @@
+package httpmitm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	WebSocketGUID    = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	WebSocketVersion = "13"
+
+	// MaxWebSocketMessage is the max size of a message read, including all fragments.
+	MaxWebSocketMessage = 16 << 20
+)
+
+// WebSocket frame opcodes defined by RFC 6455
+const (
+	WebSocketContinuation = 0x0
+	WebSocketText         = 0x1
+	WebSocketBinary       = 0x2
+	WebSocketClose        = 0x8
+	WebSocketPing         = 0x9
+	WebSocketPong         = 0xa
+)
+
+// WebSocket close codes defined by RFC 6455
+const (
+	WebSocketCloseNormal        = 1000
+	WebSocketCloseGoingAway     = 1001
+	WebSocketCloseProtocolError = 1002
+	WebSocketCloseNoStatus      = 1005
+	WebSocketCloseInternalError = 1011
+)
+
+var (
+	ErrWebSocketHandshake = errors.New("invalid websocket handshake. Please making sure Upgrade, Connection, Sec-WebSocket-Version and Sec-WebSocket-Key headers are supplied")
+	ErrWebSocketFrame     = errors.New("invalid websocket frame")
+	ErrWebSocketUnexpect  = errors.New("unexpected websocket message")
+)
+
+// WebSocketCloseError represents a close frame received from peer.
+type WebSocketCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *WebSocketCloseError) Error() string {
+	return "websocket closed with " + strconv.Itoa(e.Code) + ": " + e.Reason
+}
+
+// WebSocketConn is a minimal RFC 6455 connection used by both side of mocked WebSocket session.
+// NOTE: frames written by client side are masked as required by RFC 6455.
+type WebSocketConn struct {
+	mux sync.Mutex
+
+	rwc       io.ReadWriteCloser
+	client    bool
+	closeSent bool
+	pongs     [][]byte // pongs received between fragments of a message
+}
+
+// NewWebSocketClient returns client side of WebSocketConn, the rwc is usually the body of 101 response.
+func NewWebSocketClient(rwc io.ReadWriteCloser) *WebSocketConn {
+	return &WebSocketConn{
+		rwc:    rwc,
+		client: true,
+	}
+}
+
+func newWebSocketServer(rwc io.ReadWriteCloser) *WebSocketConn {
+	return &WebSocketConn{
+		rwc: rwc,
+	}
+}
+
+// WriteText sends a text message
+func (c *WebSocketConn) WriteText(text string) error {
+	return c.WriteMessage(WebSocketText, []byte(text))
+}
+
+// WriteMessage sends a message of opcode with data as a single frame
+func (c *WebSocketConn) WriteMessage(opcode int, data []byte) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.closeSent {
+		return net.ErrClosed
+	}
+
+	if opcode == WebSocketClose {
+		c.closeSent = true
+	}
+
+	return c.writeFrame(opcode, data)
+}
+
+// Ping sends a ping frame, the pong is returned by ReadMessage
+func (c *WebSocketConn) Ping(data []byte) error {
+	return c.WriteMessage(WebSocketPing, data)
+}
+
+// Close sends a close frame with code and reason.
+// NOTE: It does not close the underlying connection, which is closed after close frame echoed.
+func (c *WebSocketConn) Close(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+
+	return c.WriteMessage(WebSocketClose, payload)
+}
+
+// ReadMessage returns the next data or pong message from peer, pings are answered automatically.
+// NOTE: It returns *WebSocketCloseError when a close frame received, and pongs received between
+// fragments of a message are returned after the message.
+func (c *WebSocketConn) ReadMessage() (opcode int, data []byte, err error) {
+	if len(c.pongs) > 0 {
+		pong := c.pongs[0]
+		c.pongs = c.pongs[1:]
+
+		return WebSocketPong, pong, nil
+	}
+
+	for {
+		fin, frameop, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch frameop {
+		case WebSocketPing:
+			c.mux.Lock()
+			if !c.closeSent {
+				err = c.writeFrame(WebSocketPong, payload)
+			}
+			c.mux.Unlock()
+
+			if err != nil {
+				return 0, nil, err
+			}
+
+		case WebSocketPong:
+			if opcode == 0 {
+				return frameop, payload, nil
+			}
+
+			c.pongs = append(c.pongs, payload)
+
+		case WebSocketClose:
+			closeErr := &WebSocketCloseError{
+				Code: WebSocketCloseNoStatus,
+			}
+			if len(payload) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(payload))
+				closeErr.Reason = string(payload[2:])
+			}
+
+			// echo close frame for handshake
+			c.mux.Lock()
+			if !c.closeSent {
+				c.closeSent = true
+
+				c.writeFrame(WebSocketClose, payload)
+			}
+			c.mux.Unlock()
+
+			return frameop, nil, closeErr
+
+		case WebSocketContinuation:
+			if opcode == 0 {
+				return 0, nil, ErrWebSocketFrame
+			}
+
+			if len(data)+len(payload) > MaxWebSocketMessage {
+				return 0, nil, fmt.Errorf("%w: message exceeds %d bytes", ErrWebSocketFrame, MaxWebSocketMessage)
+			}
+
+			data = append(data, payload...)
+			if fin {
+				return opcode, data, nil
+			}
+
+		default:
+			// NOTE: a new message is not allowed before the fragmented one finished
+			if opcode != 0 {
+				return 0, nil, ErrWebSocketFrame
+			}
+
+			opcode, data = frameop, payload
+			if fin {
+				return opcode, data, nil
+			}
+		}
+	}
+}
+
+// ReadText returns the next text message from peer
+func (c *WebSocketConn) ReadText() (string, error) {
+	opcode, data, err := c.ReadMessage()
+	if err != nil {
+		return "", err
+	}
+
+	if opcode != WebSocketText {
+		return "", fmt.Errorf("%w: expected text frame, but got opcode 0x%x", ErrWebSocketUnexpect, opcode)
+	}
+
+	return string(data), nil
+}
+
+// Underlying returns the underlying connection
+func (c *WebSocketConn) Underlying() io.ReadWriteCloser {
+	return c.rwc
+}
+
+func (c *WebSocketConn) writeFrame(opcode int, payload []byte) error {
+	buf := bytes.NewBuffer(make([]byte, 0, 14+len(payload)))
+	buf.WriteByte(0x80 | byte(opcode))
+
+	var mask byte
+	if c.client {
+		mask = 0x80
+	}
+
+	switch size := len(payload); {
+	case size < 126:
+		buf.WriteByte(mask | byte(size))
+
+	case size <= 0xffff:
+		buf.WriteByte(mask | 126)
+		binary.Write(buf, binary.BigEndian, uint16(size))
+
+	default:
+		buf.WriteByte(mask | 127)
+		binary.Write(buf, binary.BigEndian, uint64(size))
+	}
+
+	if c.client {
+		var key [4]byte
+		rand.Read(key[:])
+
+		buf.Write(key[:])
+		for i, b := range payload {
+			buf.WriteByte(b ^ key[i%4])
+		}
+	} else {
+		buf.Write(payload)
+	}
+
+	_, err := c.rwc.Write(buf.Bytes())
+	return err
+}
+
+func (c *WebSocketConn) readFrame() (fin bool, opcode int, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.rwc, head[:]); err != nil {
+		return
+	}
+
+	fin = head[0]&0x80 != 0
+	opcode = int(head[0] & 0x0f)
+	masked := head[1]&0x80 != 0
+
+	// frames sent from client must be masked, and vice versa
+	if masked == c.client {
+		err = ErrWebSocketFrame
+		return
+	}
+
+	size := uint64(head[1] & 0x7f)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.rwc, ext[:]); err != nil {
+			return
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.rwc, ext[:]); err != nil {
+			return
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+
+	// control frames must not be fragmented, and their payloads are at most 125 bytes
+	if opcode >= WebSocketClose && (!fin || size > 125) {
+		err = ErrWebSocketFrame
+		return
+	}
+
+	if size > MaxWebSocketMessage {
+		err = fmt.Errorf("%w: payload of %d bytes exceeds %d bytes", ErrWebSocketFrame, size, MaxWebSocketMessage)
+		return
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.rwc, key[:]); err != nil {
+			return
+		}
+	}
+
+	payload = make([]byte, size)
+	if _, err = io.ReadFull(c.rwc, payload); err != nil {
+		return
+	}
+
+	if masked {
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+
+	return
+}
+
+// WebSocketStep defines a scripted action of server side of mocked WebSocket session
+type WebSocketStep func(conn *WebSocketConn) error
+
+// WebSocketSend returns WebSocketStep which sends a message of opcode
+func WebSocketSend(opcode int, data []byte) WebSocketStep {
+	return func(conn *WebSocketConn) error {
+		return conn.WriteMessage(opcode, data)
+	}
+}
+
+// WebSocketSendText returns WebSocketStep which sends a text message
+func WebSocketSendText(text string) WebSocketStep {
+	return func(conn *WebSocketConn) error {
+		return conn.WriteText(text)
+	}
+}
+
+// WebSocketExpectText returns WebSocketStep which expects a text message from client
+func WebSocketExpectText(text string) WebSocketStep {
+	return func(conn *WebSocketConn) error {
+		got, err := conn.ReadText()
+		if err != nil {
+			return err
+		}
+
+		if got != text {
+			return fmt.Errorf("%w: expected %q, but got %q", ErrWebSocketUnexpect, text, got)
+		}
+
+		return nil
+	}
+}
+
+// WebSocketPingPong returns WebSocketStep which sends a ping and expects pong from client
+func WebSocketPingPong(data []byte) WebSocketStep {
+	return func(conn *WebSocketConn) error {
+		if err := conn.Ping(data); err != nil {
+			return err
+		}
+
+		opcode, payload, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		if opcode != WebSocketPong || !bytes.Equal(payload, data) {
+			return fmt.Errorf("%w: expected pong of %q, but got opcode 0x%x with %q", ErrWebSocketUnexpect, data, opcode, payload)
+		}
+
+		return nil
+	}
+}
+
+// WebSocketCloseWith returns WebSocketStep which sends a close frame and waits for echo of client
+func WebSocketCloseWith(code int, reason string) WebSocketStep {
+	return func(conn *WebSocketConn) error {
+		if err := conn.Close(code, reason); err != nil {
+			return err
+		}
+
+		for {
+			_, _, err := conn.ReadMessage()
+
+			var closeErr *WebSocketCloseError
+			if errors.As(err, &closeErr) {
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// WebSocketResponder completes WebSocket handshake and runs server side of the session in-process.
+type WebSocketResponder struct {
+	handler func(conn *WebSocketConn, r *http.Request) error
+}
+
+// NewWebSocketResponder returns WebSocketResponder with handler invoked for server side of each session
+func NewWebSocketResponder(handler func(conn *WebSocketConn, r *http.Request) error) http.RoundTripper {
+	return &WebSocketResponder{
+		handler: handler,
+	}
+}
+
+// NewWebSocketScriptResponder returns WebSocketResponder which runs steps in order for each session
+func NewWebSocketScriptResponder(steps ...WebSocketStep) http.RoundTripper {
+	return NewWebSocketResponder(func(conn *WebSocketConn, r *http.Request) error {
+		for _, step := range steps {
+			if err := step(conn); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// RoundTrip implements http.RoundTripper
+func (ws *WebSocketResponder) RoundTrip(req *http.Request) (*http.Response, error) {
+	accept, err := acceptWebSocketKey(req)
+	if err != nil {
+		return NewResponder(http.StatusBadRequest, nil, err.Error()).RoundTrip(req)
+	}
+
+	client, server := net.Pipe()
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		conn := newWebSocketServer(server)
+
+		if err := ws.handler(conn, req); err != nil {
+			conn.Close(WebSocketCloseInternalError, err.Error())
+		}
+
+		server.Close()
+	}()
+
+	// abort session when request canceled
+	if ctxdone := req.Context().Done(); ctxdone != nil {
+		go func() {
+			select {
+			case <-ctxdone:
+				server.Close()
+
+			case <-done:
+			}
+		}()
+	}
+
+	header := http.Header{}
+	header.Set("Upgrade", "websocket")
+	header.Set("Connection", "Upgrade")
+	header.Set("Sec-WebSocket-Accept", accept)
+	if protocol := req.Header.Get("Sec-WebSocket-Protocol"); protocol != "" {
+		header.Set("Sec-WebSocket-Protocol", strings.TrimSpace(strings.Split(protocol, ",")[0]))
+	}
+
+	return &http.Response{
+		Status:     responseStatus(http.StatusSwitchingProtocols),
+		StatusCode: http.StatusSwitchingProtocols,
+		Header:     header,
+		Body:       client,
+		Request:    req,
+	}, nil
+}
+
+// NewWebSocketRequest returns a GET request with WebSocket handshake headers
+func NewWebSocketRequest(rawurl string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var key [16]byte
+	rand.Read(key[:])
+
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Version", WebSocketVersion)
+	req.Header.Set("Sec-WebSocket-Key", base64.StdEncoding.EncodeToString(key[:]))
+
+	return req, nil
+}
+
+// WebSocketAccept returns the expected value of Sec-WebSocket-Accept header for key
+func WebSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + WebSocketGUID))
+
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func acceptWebSocketKey(req *http.Request) (string, error) {
+	if !headerContainsToken(req.Header, "Connection", "upgrade") || !headerContainsToken(req.Header, "Upgrade", "websocket") {
+		return "", ErrWebSocketHandshake
+	}
+
+	if req.Header.Get("Sec-WebSocket-Version") != WebSocketVersion {
+		return "", ErrWebSocketHandshake
+	}
+
+	key := req.Header.Get("Sec-WebSocket-Key")
+
+	nonce, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(nonce) != 16 {
+		return "", ErrWebSocketHandshake
+	}
+
+	return WebSocketAccept(key), nil
+}
+
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,233 @@
+package httpmitm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+)
+
+func Test_WebSocketAccept(t *testing.T) {
+	it := assert.New(t)
+
+	// example of RFC 6455
+	it.Equal("s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", WebSocketAccept("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+func Test_NewWebSocketScriptResponder(t *testing.T) {
+	it := assert.New(t)
+
+	responder := NewWebSocketScriptResponder(
+		WebSocketSendText("hello"),
+		WebSocketExpectText("ping?"),
+		WebSocketPingPong([]byte("heartbeat")),
+		WebSocketCloseWith(WebSocketCloseNormal, "bye"),
+	)
+	it.Implements((*http.RoundTripper)(nil), responder)
+
+	request, _ := NewWebSocketRequest(mockURL)
+	response, err := responder.RoundTrip(request)
+	it.Nil(err)
+	it.Equal(http.StatusSwitchingProtocols, response.StatusCode)
+	it.Equal(WebSocketAccept(request.Header.Get("Sec-WebSocket-Key")), response.Header.Get("Sec-WebSocket-Accept"))
+
+	rwc, ok := response.Body.(io.ReadWriteCloser)
+	it.True(ok)
+	defer rwc.Close()
+
+	conn := NewWebSocketClient(rwc)
+
+	text, err := conn.ReadText()
+	it.Nil(err)
+	it.Equal("hello", text)
+
+	it.Nil(conn.WriteText("ping?"))
+
+	// ping is answered automatically, close is returned as error
+	_, _, err = conn.ReadMessage()
+
+	var closeErr *WebSocketCloseError
+	it.True(errors.As(err, &closeErr))
+	it.Equal(WebSocketCloseNormal, closeErr.Code)
+	it.Equal("bye", closeErr.Reason)
+}
+
+func Test_NewWebSocketResponderWithUnexpected(t *testing.T) {
+	it := assert.New(t)
+
+	responder := NewWebSocketScriptResponder(
+		WebSocketExpectText("hello"),
+	)
+
+	request, _ := NewWebSocketRequest(mockURL)
+	response, err := responder.RoundTrip(request)
+	it.Nil(err)
+
+	conn := NewWebSocketClient(response.Body.(io.ReadWriteCloser))
+	defer response.Body.Close()
+
+	it.Nil(conn.WriteText("world"))
+
+	_, _, err = conn.ReadMessage()
+
+	var closeErr *WebSocketCloseError
+	it.True(errors.As(err, &closeErr))
+	it.Equal(WebSocketCloseInternalError, closeErr.Code)
+	it.Contains(closeErr.Reason, ErrWebSocketUnexpect.Error())
+}
+
+func Test_NewWebSocketResponderWithInvalidHandshake(t *testing.T) {
+	it := assert.New(t)
+
+	responder := NewWebSocketResponder(func(conn *WebSocketConn, r *http.Request) error {
+		return nil
+	})
+
+	request, _ := NewWebSocketRequest(mockURL)
+	request.Header.Set("Sec-WebSocket-Key", "invalid")
+
+	response, err := responder.RoundTrip(request)
+	it.Nil(err)
+	it.Equal(http.StatusBadRequest, response.StatusCode)
+}
+
+func Test_MitmTransportWithWebSocket(t *testing.T) {
+	mt := NewMitmTransport().StubDefaultTransport(t)
+	defer mt.UnstubDefaultTransport()
+
+	it := assert.New(t)
+
+	// mocks
+	mt.MockRequest("GET", mockURL+"/ws").WithResponser(NewWebSocketResponder(func(conn *WebSocketConn, r *http.Request) error {
+		text, err := conn.ReadText()
+		if err != nil {
+			return err
+		}
+
+		return conn.WriteText("echo: " + text)
+	}))
+
+	request, _ := NewWebSocketRequest(stubURL + "/ws")
+	response, err := http.DefaultClient.Do(request)
+	it.Nil(err)
+	it.Equal(http.StatusSwitchingProtocols, response.StatusCode)
+
+	conn := NewWebSocketClient(response.Body.(io.ReadWriteCloser))
+	defer response.Body.Close()
+
+	it.Nil(conn.WriteText("hi"))
+
+	text, err := conn.ReadText()
+	it.Nil(err)
+	it.Equal("echo: hi", text)
+}
+
+func Test_WebSocketConnWithFragments(t *testing.T) {
+	it := assert.New(t)
+
+	pong := make(chan []byte, 1)
+
+	responder := NewWebSocketResponder(func(conn *WebSocketConn, r *http.Request) error {
+		// NOTE: net.Pipe is synchronous, frames are written while reading pong answered by client
+		written := make(chan error, 1)
+		go func() {
+			_, err := conn.Underlying().Write([]byte{
+				WebSocketText, 3, 'a', 'b', 'c',
+				0x80 | WebSocketPing, 1, 'x',
+				0x80 | WebSocketPong, 1, 'y',
+				0x80 | WebSocketContinuation, 2, 'd', 'e',
+			})
+
+			written <- err
+		}()
+
+		opcode, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if opcode == WebSocketPong {
+			pong <- data
+		}
+
+		return <-written
+	})
+
+	request, _ := NewWebSocketRequest(mockURL)
+	response, err := responder.RoundTrip(request)
+	if !it.Nil(err) {
+		return
+	}
+	defer response.Body.Close()
+
+	conn := NewWebSocketClient(response.Body.(io.ReadWriteCloser))
+
+	opcode, data, err := conn.ReadMessage()
+	it.Nil(err)
+	it.Equal(WebSocketText, opcode)
+	it.Equal("abcde", string(data))
+
+	// pong between fragments is returned after the message
+	opcode, data, err = conn.ReadMessage()
+	it.Nil(err)
+	it.Equal(WebSocketPong, opcode)
+	it.Equal("y", string(data))
+
+	// ping between fragments is answered
+	it.Equal("x", string(<-pong))
+}
+
+func Test_WebSocketConnWithOversizedFrame(t *testing.T) {
+	it := assert.New(t)
+
+	responder := NewWebSocketResponder(func(conn *WebSocketConn, r *http.Request) error {
+		conn.Underlying().Write([]byte{0x80 | WebSocketBinary, 127, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+
+		return nil
+	})
+
+	request, _ := NewWebSocketRequest(mockURL)
+	response, err := responder.RoundTrip(request)
+	if !it.Nil(err) {
+		return
+	}
+	defer response.Body.Close()
+
+	conn := NewWebSocketClient(response.Body.(io.ReadWriteCloser))
+
+	_, _, err = conn.ReadMessage()
+	it.True(errors.Is(err, ErrWebSocketFrame))
+	it.Contains(err.Error(), "exceeds")
+}
+
+func Test_WebSocketResponderWithoutLeak(t *testing.T) {
+	it := assert.New(t)
+
+	responder := NewWebSocketResponder(func(conn *WebSocketConn, r *http.Request) error {
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	goroutines := runtime.NumGoroutine()
+
+	for i := 0; i < 10; i++ {
+		request, _ := NewWebSocketRequest(mockURL)
+
+		response, err := responder.RoundTrip(request.WithContext(ctx))
+		if it.Nil(err) {
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+		}
+	}
+
+	for i := 0; i < 100 && runtime.NumGoroutine() > goroutines; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	it.True(runtime.NumGoroutine() <= goroutines)
+}